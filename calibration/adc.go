@@ -1,20 +1,29 @@
 package calibration
 
 import (
+	"context"
+	"errors"
 	"fmt"
+	"log"
 	"time"
 
+	file "github.com/CK6170/Calrunrilla-go/file"
+	"github.com/CK6170/Calrunrilla-go/matrix"
 	serialpkg "github.com/CK6170/Calrunrilla-go/serial"
 	"github.com/CK6170/Calrunrilla-go/ui"
 )
 
-func showADCLabel(bars *serialpkg.Leo485, message string, finalLabel string) ([]int64, bool) {
+// showADCLabel prints message and runs manipulateADC.
+func showADCLabel(bars *serialpkg.Leo485, message string, finalLabel string) ([]int64, float64, bool) {
 	// Green instruction line
 	fmt.Printf("\033[32m%s\033[0m\n", message)
 	return manipulateADC(bars, finalLabel)
 }
 
-func manipulateADC(bars *serialpkg.Leo485, finalLabel string) ([]int64, bool) {
+// manipulateADC shows live readings until 'C', then discards IGNORE samples
+// and averages AVG samples. It returns the averages of all load cells in
+// order, their sampling spread (see sampleSpread) and false on <ESC>.
+func manipulateADC(bars *serialpkg.Leo485, finalLabel string) ([]int64, float64, bool) {
 	// Print instruction once
 	fmt.Println()
 	// Clear any pending key presses from previous phase to avoid accidental triggers
@@ -52,7 +61,7 @@ func manipulateADC(bars *serialpkg.Leo485, finalLabel string) ([]int64, bool) {
 			select {
 			case k := <-keyEvents:
 				if k == 27 { // ESC
-					return nil, false
+					return nil, 0, false
 				}
 				if k == 'C' || k == 'c' {
 					phase = "ignoring"
@@ -72,7 +81,7 @@ func manipulateADC(bars *serialpkg.Leo485, finalLabel string) ([]int64, bool) {
 				}
 				currentSample[i] = full
 			} else {
-				currentSample[i] = make([]int64, bars.NLCs)
+				currentSample[i] = make([]int64, bars.NLCsPerBar(i))
 			}
 		}
 
@@ -100,21 +109,21 @@ func manipulateADC(bars *serialpkg.Leo485, finalLabel string) ([]int64, bool) {
 			ui.PrintAveragingLine(bars, currentSample, avgCounter, avgTarget)
 			if avgCounter >= avgTarget {
 				phase = "finished"
-				finalAverages = calculateFinalAverages(samples, bars.NLCs)
+				finalAverages = calculateFinalAverages(samples, bars.LCsPerBar())
 			}
 		case "finished":
 			// Show final averages once, then automatically advance (no key required)
 			ui.PrintFinalLine(bars, finalAverages, finalLabel)
 			// Flatten final averages to []int64 for downstream use
-			flat := make([]int64, len(bars.Bars)*bars.NLCs)
+			flat := make([]int64, bars.TotalLCs())
 			for i := range bars.Bars {
 				if i < len(finalAverages) {
-					for lc := 0; lc < bars.NLCs && lc < len(finalAverages[i]); lc++ {
-						flat[i*bars.NLCs+lc] = finalAverages[i][lc]
+					for lc := 0; lc < bars.NLCsPerBar(i) && lc < len(finalAverages[i]); lc++ {
+						flat[bars.LCOffset(i)+lc] = finalAverages[i][lc]
 					}
 				}
 			}
-			return flat, true
+			return flat, sampleSpread(samples), true
 		}
 
 		// Small sleep to prevent excessive CPU usage
@@ -122,28 +131,120 @@ func manipulateADC(bars *serialpkg.Leo485, finalLabel string) ([]int64, bool) {
 	}
 }
 
-func calculateFinalAverages(samples [][][]int64, nlcs int) [][]int64 {
+// sampleSpread returns the standard deviation of the averaged samples of
+// each load cell, averaged over all load cells, in ADC counts.
+func sampleSpread(samples [][][]int64) float64 {
+	var spreads []float64
+	for _, barSamples := range samples {
+		if len(barSamples) < 2 {
+			continue
+		}
+		for lc := range barSamples[0] {
+			values := make([]int64, 0, len(barSamples))
+			for _, sample := range barSamples {
+				if lc < len(sample) {
+					values = append(values, sample[lc])
+				}
+			}
+			if len(values) > 1 {
+				spreads = append(spreads, matrix.StdDevInt64(values))
+			}
+		}
+	}
+	if len(spreads) == 0 {
+		return 0
+	}
+	return matrix.Mean(spreads)
+}
+
+func calculateFinalAverages(samples [][][]int64, lcsPerBar []int) [][]int64 {
 	finalAverages := make([][]int64, len(samples))
 	for i, barSamples := range samples {
+		nlcs := lcsPerBar[i]
 		if len(barSamples) == 0 {
 			finalAverages[i] = make([]int64, nlcs)
 			continue
 		}
-		counts := make([]int64, nlcs)
-		sums := make([]int64, nlcs)
+		readings := make([][]int64, nlcs)
 		for _, sample := range barSamples {
 			for lc := 0; lc < nlcs && lc < len(sample); lc++ {
-				sums[lc] += sample[lc]
-				counts[lc]++
+				readings[lc] = append(readings[lc], sample[lc])
 			}
 		}
-		avg := make([]int64, nlcs)
-		for lc := 0; lc < nlcs; lc++ {
-			if counts[lc] > 0 {
-				avg[lc] = sums[lc] / counts[lc]
+		finalAverages[i] = truncatedMeans(readings)
+	}
+	return finalAverages
+}
+
+// truncatedMeans returns the mean of each slice of readings truncated to a
+// whole count, 0 for a slice without readings. The sums are kept in integers
+// so a whole mean is never truncated to the count below it.
+func truncatedMeans(readings [][]int64) []int64 {
+	avg := make([]int64, len(readings))
+	for i, r := range readings {
+		if len(r) == 0 {
+			continue
+		}
+		var sum int64
+		for _, x := range r {
+			sum += x
+		}
+		avg[i] = sum / int64(len(r))
+	}
+	return avg
+}
+
+// ReadRawADCs reads every bar once and returns the raw counts per bar, per
+// load cell, without applying zeros or factors. Bars that do not answer are
+// left empty and reported in the returned error; the other bars are still
+// read.
+func ReadRawADCs(ctx context.Context, bars *serialpkg.Leo485) ([][]int64, error) {
+	adcs := make([][]int64, len(bars.Bars))
+	var errs []error
+	for i := range bars.Bars {
+		if err := ctx.Err(); err != nil {
+			return adcs, err
+		}
+		ad, err := bars.GetADs(i)
+		if err != nil {
+			errs = append(errs, fmt.Errorf("bar %d: %v", i+1, err))
+			continue
+		}
+		adcs[i] = make([]int64, bars.NLCsPerBar(i))
+		for lc := range adcs[i] {
+			if lc < len(ad) {
+				adcs[i][lc] = int64(ad[lc])
 			}
 		}
-		finalAverages[i] = avg
 	}
-	return finalAverages
+	return adcs, errors.Join(errs...)
+}
+
+// RawADCConfig connects to the bars of a config, prints one pass of raw ADC
+// counts and exits; it is meant for diagnosing a dead load cell.
+func RawADCConfig(configPath string) {
+	loaded, err := file.LoadParameters(configPath)
+	if err != nil {
+		log.Fatalf("Invalid config %s:\n%v", configPath, err)
+	}
+	parameters := *loaded
+	bars, err := ConnectWithRecovery(configPath, &parameters, false, printStatus)
+	if err != nil {
+		log.Fatalf("Cannot connect to the bars: %v", err)
+	}
+	defer func() { _ = bars.Close() }()
+	adcs, err := ReadRawADCs(context.Background(), bars)
+	for i, ad := range adcs {
+		if ad == nil {
+			continue
+		}
+		fmt.Printf("%s:", parameters.BARS[i].Name(i))
+		for _, v := range ad {
+			fmt.Printf(" %12d", v)
+		}
+		fmt.Println()
+	}
+	if err != nil {
+		log.Printf("Raw ADC read errors:\n%v", err)
+	}
 }
@@ -0,0 +1,82 @@
+package calibration
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	file "github.com/CK6170/Calrunrilla-go/file"
+	"github.com/CK6170/Calrunrilla-go/matrix"
+	serialpkg "github.com/CK6170/Calrunrilla-go/serial"
+	"github.com/CK6170/Calrunrilla-go/ui"
+)
+
+// ReadDeviceCalibration reads the factors and zeros currently stored on every
+// bar and returns a copy of parameters with the LC entries populated from the
+// device. The passed parameters are not modified.
+func ReadDeviceCalibration(bars *serialpkg.Leo485, parameters *PARAMETERS) (*PARAMETERS, error) {
+	out := *parameters
+	out.META = nil
+	if parameters.SERIAL != nil {
+		ser := *parameters.SERIAL
+		out.SERIAL = &ser
+	}
+	out.BARS = make([]*BAR, len(parameters.BARS))
+	for i, bar := range parameters.BARS {
+		factors, err := bars.ReadFactors(i)
+		if err != nil {
+			return nil, fmt.Errorf("bar %d: %v", i+1, err)
+		}
+		zeros, err := bars.ReadZeros(i)
+		if err != nil {
+			return nil, fmt.Errorf("bar %d: %v", i+1, err)
+		}
+		if len(zeros) != len(factors) {
+			return nil, fmt.Errorf("bar %d: %d zeros for %d factors", i+1, len(zeros), len(factors))
+		}
+		b := *bar
+		b.LC = make([]*LC, len(factors))
+		for j := range factors {
+			b.LC[j] = &LC{
+				ZERO:   float64(zeros[j]),
+				FACTOR: float32(factors[j]),
+				IEEE:   matrix.FormatIEEEHex(float32(factors[j])),
+				LABEL:  lcLabel(bar.LC, j),
+			}
+		}
+		out.BARS[i] = &b
+		time.Sleep(50 * time.Millisecond)
+	}
+	return &out, nil
+}
+
+// BackupDeviceCalibration archives the calibration currently stored on the
+// device next to configPath as <name>_backup_<timestamp>.json and returns the
+// path written.
+func BackupDeviceCalibration(bars *serialpkg.Leo485, parameters *PARAMETERS, configPath string, appVer string, appBuild string) (string, error) {
+	current, err := ReadDeviceCalibration(bars, parameters)
+	if err != nil {
+		return "", err
+	}
+	path := fmt.Sprintf("%s_backup_%s.json", strings.TrimSuffix(configPath, ".json"), time.Now().Format("20060102-150405"))
+	if err := file.SaveToJSON(path, current, appVer, appBuild); err != nil {
+		return "", err
+	}
+	return path, nil
+}
+
+// backupBeforeFlash runs BackupDeviceCalibration when opts.Backup is set. It
+// returns false when the backup failed, in which case the caller must not flash.
+func backupBeforeFlash(bars *serialpkg.Leo485, parameters *PARAMETERS, configPath string, appVer string, appBuild string, opts Options) bool {
+	if !opts.Backup {
+		return true
+	}
+	ui.Greenf("Reading current calibration from the bars for backup...\n")
+	path, err := BackupDeviceCalibration(bars, parameters, configPath, appVer, appBuild)
+	if err != nil {
+		ui.Warningf("Backup before flash failed: %v\n", err)
+		return false
+	}
+	ui.Debugf(parameters.DEBUG, "Device calibration backed up to %s\n", path)
+	return true
+}
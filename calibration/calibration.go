@@ -1,10 +1,12 @@
 package calibration
 
 import (
-	"encoding/json"
+	"errors"
 	"fmt"
 	"log"
+	"math"
 	"os"
+	"strconv"
 	"strings"
 	"time"
 
@@ -13,7 +15,6 @@ import (
 	models "github.com/CK6170/Calrunrilla-go/models"
 	serialpkg "github.com/CK6170/Calrunrilla-go/serial"
 	"github.com/CK6170/Calrunrilla-go/ui"
-	"github.com/tarm/serial"
 )
 
 // at the exported types in the models package.
@@ -33,7 +34,7 @@ type Vector = matrix.Vector
 type Leo485 = serialpkg.Leo485
 
 var (
-	calibmsg       = "\nPut %d on the %s Bay on the %s side in the %s of the Shelf and Press 'C' to continue. Or <ESC> to exit."
+	calibmsg       = "\nPut %s on the %s Bay on the %s side in the %s of the %s and Press 'C' to continue. Or <ESC> to exit."
 	zeromsg        = "\nClear the Bay(s) and Press 'C' to continue. Or <ESC> to exit."
 	lastParameters *PARAMETERS // store parsed parameters for dynamic targets
 	immediateRetry bool
@@ -42,98 +43,42 @@ var (
 // GetLastParameters returns the most recently loaded parameters used in calibration.
 func GetLastParameters() *PARAMETERS { return lastParameters }
 
-func CalRunrilla(args0 string, barsPerRow int, appVer string, appBuild string) {
-	jsonData, err := os.ReadFile(args0)
-	if err != nil {
-		log.Fatalf("Error reading file: %v", err)
-	}
+// Options holds the command line choices that change how CalRunrilla and
+// FlashOnly run.
+type Options struct {
+	Backup bool // archive the calibration on the bars before flashing (--backup)
+}
 
-	var parameters PARAMETERS
-	if err := json.Unmarshal(jsonData, &parameters); err != nil {
-		log.Fatalf("JSON error: %v", err)
+func CalRunrilla(args0 string, barsPerRow int, appVer string, appBuild string, opts Options) {
+	loaded, err := file.LoadParameters(args0)
+	if err != nil {
+		log.Fatalf("Invalid config %s:\n%v", args0, err)
 	}
+	parameters := *loaded
 	// Inform user config loaded (debug-only yellow)
 	ui.Debugf(parameters.DEBUG, "Loaded config: %s (DEBUG=%v)\n", args0, parameters.DEBUG)
+	if parameters.SHELF != "" {
+		ui.Greenf("Shelf: %s\n", parameters.SHELF)
+	}
 
 	// Fallback: if IGNORE not provided use AVG
 	if parameters.IGNORE <= 0 {
 		parameters.IGNORE = parameters.AVG
 	}
+	// A META block loaded from a previously calibrated file describes that
+	// earlier run; start this run with a fresh one.
+	parameters.META = nil
 	lastParameters = &parameters
 
-	if len(parameters.BARS) == 0 {
-		log.Fatal("No Bars defined")
-	}
-
-	// Ensure we have a working serial port: if PORT missing OR cannot be opened OR version probe fails, auto-detect.
-	if parameters.SERIAL == nil {
-		log.Fatal("Missing SERIAL section in JSON")
-	}
+	// Ensure we have a working serial port and answering bars: auto-detect,
+	// reboot and re-detect as needed (see ConnectWithRecovery).
 	ui.Debugf(parameters.DEBUG, "Validating SERIAL configuration...\n")
-	needDetect := false
-	if parameters.SERIAL.PORT == "" {
-		ui.Debugf(parameters.DEBUG, "Serial PORT missing in JSON, attempting auto-detect...\n")
-		needDetect = true
-	} else {
-		// Try opening specified port directly before constructing Leo485 to avoid fatal inside NewLeo485
-		ui.Debugf(parameters.DEBUG, "Trying configured port: %s (baud %d)\n", parameters.SERIAL.PORT, parameters.SERIAL.BAUDRATE)
-		cfg := &serial.Config{Name: parameters.SERIAL.PORT, Baud: parameters.SERIAL.BAUDRATE, Parity: serial.ParityNone, Size: 8, StopBits: serial.Stop1, ReadTimeout: time.Millisecond * 300}
-		sp, err := serial.OpenPort(cfg)
-		if err != nil {
-			log.Printf("Port %s open failed (%v), attempting auto-detect...\n", parameters.SERIAL.PORT, err)
-			needDetect = true
-		} else {
-			_ = sp.Close()
-		}
-	}
-	if needDetect {
-		ui.Debugf(parameters.DEBUG, "Starting serial auto-detect across COM ports (this may take a few seconds)...\n")
-		p := serialpkg.AutoDetectPort(&parameters)
-		if p == "" {
-			log.Fatal("Could not auto-detect serial port")
-		}
-		parameters.SERIAL.PORT = p
-		file.PersistParameters(args0, &parameters)
-		ui.Debugf(parameters.DEBUG, "Detected serial port: %s (saved to JSON)\n", p)
+	bars, err := ConnectWithRecovery(args0, &parameters, true, printStatus)
+	if err != nil {
+		log.Fatalf("Cannot connect to the bars: %v", err)
 	}
-
-	ui.Debugf(parameters.DEBUG, "Opening Leo485 with port %s...\n", parameters.SERIAL.PORT)
-	bars := serialpkg.NewLeo485(parameters.SERIAL, parameters.BARS)
 	defer func() { _ = bars.Close() }()
 
-	// Quick version probe; if fails, try auto-detect fallback (in case wrong but openable port)
-	ui.Debugf(parameters.DEBUG, "Probing device version...\n")
-	if !ProbeVersion(bars, &parameters) {
-		log.Printf("No version response from %s. Attempting reboot of all bars...\n", parameters.SERIAL.PORT)
-		// Try to reboot each bar once and allow time to recover
-		for i := range bars.Bars {
-			if bars.Reboot(i) {
-				ui.Greenf("Bar %d reboot command sent\n", i+1)
-			} else {
-				log.Printf("Bar %d reboot command failed or no response\n", i+1)
-			}
-			time.Sleep(200 * time.Millisecond)
-		}
-		// Wait a short while for devices to restart
-		ui.Greenf("Waiting for bars to reboot...\n")
-		time.Sleep(1500 * time.Millisecond)
-		// Try probing again
-		if ProbeVersion(bars, &parameters) {
-			ui.Greenf("Version response received after reboot\n")
-		} else {
-			log.Printf("No version response from %s after reboot, re-attempting auto-detect...\n", parameters.SERIAL.PORT)
-			_ = bars.Close()
-			p := serialpkg.AutoDetectPort(&parameters)
-			if p != "" && p != parameters.SERIAL.PORT {
-				parameters.SERIAL.PORT = p
-				file.PersistParameters(args0, &parameters)
-				ui.Debugf(parameters.DEBUG, "Updated serial port after probe: %s (saved)\n", p)
-				bars = serialpkg.NewLeo485(parameters.SERIAL, parameters.BARS)
-				defer func() { _ = bars.Close() }()
-			}
-		}
-	}
-
 	// Full version validation (will continue even if minor mismatch)
 	if !checkVersion(bars, &parameters) {
 		// Version check failed but continue
@@ -146,7 +91,7 @@ func CalRunrilla(args0 string, barsPerRow int, appVer string, appBuild string) {
 	// blank line between final ZERO output and weight calibration prompt
 	fmt.Println()
 	ui.Debugf(parameters.DEBUG, "Starting weight calibration...\n")
-	adv := weightCalibration(bars, &parameters)
+	adv, spreads := weightCalibration(bars, &parameters)
 	// Empty line between last data line and matrices block
 	fmt.Println()
 	// Prompt user to clear all bays before computing factors/matrices.
@@ -171,16 +116,28 @@ func CalRunrilla(args0 string, barsPerRow int, appVer string, appBuild string) {
 		matrix.PrintMatrix(adv, "Weight Matrix (adv)", parameters.DEBUG)
 		add = adv.Sub(ad0)
 		matrix.PrintMatrix(add, "Difference Matrix (adv - ad0)", parameters.DEBUG)
-		w = matrix.NewVectorWithValue(adv.Rows, float64(parameters.WEIGHT))
+		w = matrix.NewVectorWithValue(adv.Rows, parameters.WEIGHT)
 		matrix.PrintVector(w, "Load Vector (W)", parameters.DEBUG)
 	}
 
 	// Calculate factors
-	debug := calcZerosFactors(adv, ad0, &parameters)
+	var rowWeights *matrix.Vector
+	if parameters.WEIGHTED {
+		rowWeights = stepWeights(spreads)
+	}
+	result := calcZerosFactors(adv, ad0, rowWeights, &parameters)
+	meta := metaFor(&parameters)
+	meta.WEIGHT = parameters.WEIGHT
+	meta.ERROR = result.ErrorNorm
+	meta.PINVNORM = result.PinvNorm
+	if !math.IsInf(result.Condition, 0) {
+		meta.CONDITION = result.Condition
+	}
+	meta.PLAN = planStandard
 
 	// Add to debug file
 	if parameters.DEBUG {
-		res := fmt.Sprintf("%s,%s", time.Now().Format("2006-01-02 15:04:05"), debug)
+		res := fmt.Sprintf("%s,%s", time.Now().Format("2006-01-02 15:04:05"), result.Debug)
 		file.AppendToFile(strings.Replace(args0, ".json", "_debug.csv", 1), res)
 	}
 
@@ -189,7 +146,15 @@ func CalRunrilla(args0 string, barsPerRow int, appVer string, appBuild string) {
 		resp := ui.NextYN("Do you want to flash the bars and save the parameters file? (Y/N/T)")
 		switch resp {
 		case 'Y':
-			file.SaveToJSON(strings.Replace(args0, ".json", "_calibrated.json", 1), &parameters, appVer, appBuild)
+			if _, _, err := file.SaveCalibratedJSON(args0, &parameters, appVer, appBuild); err != nil {
+				// never flash factors that are not on disk
+				ui.Warningf("Flashing skipped: the calibrated file was not saved: %v\n", err)
+				break
+			}
+			if !backupBeforeFlash(bars, &parameters, args0, appVer, appBuild, opts) {
+				ui.Warningf("Flashing skipped; run again without --backup to flash anyway\n")
+				break
+			}
 			for {
 				if err := flashParameters(bars, &parameters); err != nil {
 					log.Printf("Flash error: %v", err)
@@ -214,7 +179,7 @@ func CalRunrilla(args0 string, barsPerRow int, appVer string, appBuild string) {
 		case 'T':
 			// Run interactive testWeights and then exit calibration to avoid restart
 			ui.DrainKeys()
-			TestWeights(bars, &parameters)
+			TestWeights(bars, &parameters, args0)
 			return
 		case 'N':
 			// Show green prompt asking to Retry (R), Test (T) or Exit (ESC)
@@ -225,7 +190,7 @@ func CalRunrilla(args0 string, barsPerRow int, appVer string, appBuild string) {
 			}
 			if ch == 'T' {
 				ui.DrainKeys()
-				TestWeights(bars, &parameters)
+				TestWeights(bars, &parameters, args0)
 				// after test, exit calibration so main can resume cleanly
 				return
 			}
@@ -239,79 +204,263 @@ func CalRunrilla(args0 string, barsPerRow int, appVer string, appBuild string) {
 	}
 }
 
+// formatWeight prints a weight without trailing zeros, so integer weights
+// read as before.
+func formatWeight(w float64) string {
+	return strconv.FormatFloat(w, 'f', -1, 64)
+}
+
+// printStatus shows a ConnectWithRecovery progress message.
+func printStatus(msg string) { ui.Greenf("%s\n", msg) }
+
 func zeroCalibration(bars *serialpkg.Leo485, parameters *PARAMETERS) *matrix.Matrix {
-	ads, ok := showADCLabel(bars, zeromsg, "[ZERO]")
+	ads, _, ok := showADCLabel(bars, zeromsg, "[ZERO]")
 	if !ok {
 		log.Fatal("Process cancelled")
 	}
 	// Empty line between final data and next phase instructions
 	fmt.Println()
-	return updateMatrixZero(ads, 3*(len(parameters.BARS)-1), bars.NLCs)
+	return updateMatrixZero(ads, 3*(len(parameters.BARS)-1)*bars.MaxNLCs())
 }
 
-func weightCalibration(bars *serialpkg.Leo485, parameters *PARAMETERS) *Matrix {
-	nlcs := bars.NLCs
+// weightCalibration runs every placement step and returns the readings, one
+// row per step, with the sampling spread of each step.
+func weightCalibration(bars *serialpkg.Leo485, parameters *PARAMETERS) (*Matrix, []float64) {
+	// Bars may have different load cell counts: one column per load cell,
+	// and enough placements for the bar with the most load cells.
+	nlcs := bars.MaxNLCs()
 	nbars := len(parameters.BARS)
 	nloads := 3 * (nbars - 1) * nlcs
-	nbars *= nlcs
-	adv := matrix.NewMatrix(nloads, nbars)
+	adv := matrix.NewMatrix(nloads, bars.TotalLCs())
+	spreads := make([]float64, nloads)
 
 	for j := 0; j < nloads; j++ {
-		adv = weightCalibrationSingle(bars, parameters, adv, j)
+		adv, spreads[j] = weightCalibrationSingle(bars, parameters, adv, j)
 	}
-	return adv
+	return adv, spreads
 }
 
-func weightCalibrationSingle(bars *serialpkg.Leo485, parameters *PARAMETERS, adv *matrix.Matrix, index int) *matrix.Matrix {
-	sb := fmt.Sprintf(calibmsg, parameters.WEIGHT, (BAY)(index/6), (LMR)((index/2)%3), (FB)(index%2))
+func weightCalibrationSingle(bars *serialpkg.Leo485, parameters *PARAMETERS, adv *matrix.Matrix, index int) (*matrix.Matrix, float64) {
+	g := parameters.GEOMETRY
+	sb := fmt.Sprintf(calibmsg, formatWeight(parameters.WEIGHT), g.Bay((BAY)(index/6)), g.Side((LMR)((index/2)%3)), g.Depth((FB)(index%2)), shelfName(parameters))
 	// Label as running index (left side): [0001], [0002], ...
 	lbl := fmt.Sprintf("[%04d]", index+1)
-	ads, ok := showADCLabel(bars, sb, lbl)
+	ads, spread, ok := showADCLabel(bars, sb, lbl)
 	if !ok {
 		log.Fatal("Process cancelled")
 	}
 	// Empty line between final data and next phase instructions
 	fmt.Println()
-	return updateMatrixWeight(adv, ads, index, bars.NLCs)
+	return updateMatrixWeight(adv, ads, index), spread
+}
+
+// stepWeights turns the sampling spread of each step into a row weight for
+// the factor fit: steps at or below the median spread weigh 1, noisier steps
+// (median/spread)^2.
+func stepWeights(spreads []float64) *matrix.Vector {
+	median := matrix.Median(spreads)
+	w := matrix.NewVectorWithValue(len(spreads), 1)
+	for i, s := range spreads {
+		if s > median && median > 0 {
+			w.Values[i] = (median / s) * (median / s)
+		}
+	}
+	return w
+}
+
+// planStandard names the placement plan run by weightCalibration: every
+// bay position (LEFT/MIDDLE/RIGHT x FRONT/BACK) in turn.
+const planStandard = "standard"
+
+// CalibrationResult holds the outcome of calcZerosFactors: the quality
+// figures of the solve and the lines destined for the _debug.csv file.
+type CalibrationResult struct {
+	Debug     string
+	ErrorNorm float64 // ||add*f - W|| / WEIGHT
+	PinvNorm  float64 // norm of the pseudoinverse of add
+	Condition float64 // condition number of add; +Inf when rank deficient
+	// Lambda is the ridge parameter used (0 without REGULARIZATION) and
+	// PlainErrorNorm the ErrorNorm the unregularized factors would give.
+	Lambda         float64
+	PlainErrorNorm float64
+	// Dropped lists the empty placement steps (0-based) left out of the fit
+	// with ALLOWPARTIAL.
+	Dropped []int
+}
+
+// conditionWarning is the condition number of the difference matrix above
+// which the placement data is reported as ill-conditioned.
+const conditionWarning = 1e6
+
+// emptyStepFraction is the share of a loaded step's norm below which a
+// placement step counts as empty (no weight on the shelf).
+const emptyStepFraction = 0.01
+
+// emptySteps returns the placement steps (0-based) that never recorded a
+// reading (all-zero row of adv) or whose difference row add is negligible
+// next to a loaded step. The reference is the median norm of the recorded
+// steps that are not negligible next to the largest one, so it stays a
+// loaded step even when most steps are empty.
+func emptySteps(adv, add *matrix.Matrix) []int {
+	norms := make([]float64, add.Rows)
+	recorded := make([]bool, add.Rows)
+	peak := 0.0
+	for i := range norms {
+		norms[i] = add.GetRow(i).Norm()
+		recorded[i] = adv.GetRow(i).Norm() != 0
+		if recorded[i] {
+			peak = max(peak, norms[i])
+		}
+	}
+	var loaded []float64
+	for i, n := range norms {
+		if recorded[i] && n > emptyStepFraction*peak {
+			loaded = append(loaded, n)
+		}
+	}
+	limit := 0.0
+	if len(loaded) > 0 {
+		limit = emptyStepFraction * matrix.Median(loaded)
+	}
+	var empty []int
+	for i := range norms {
+		if !recorded[i] || norms[i] <= limit {
+			empty = append(empty, i)
+		}
+	}
+	return empty
+}
+
+// shelfName returns how prompts refer to the shelf: SHELF, or "Shelf".
+func shelfName(parameters *PARAMETERS) string {
+	if parameters.SHELF != "" {
+		return parameters.SHELF
+	}
+	return "Shelf"
+}
+
+// lcLabel returns the LABEL of load cell j in lcs, if any, so labels survive
+// rebuilding an LC slice.
+func lcLabel(lcs []*LC, j int) string {
+	if j < len(lcs) && lcs[j] != nil {
+		return lcs[j].LABEL
+	}
+	return ""
+}
+
+// stepName describes placement step index (0-based) as in the prompts.
+func stepName(index int, g *models.GEOMETRY) string {
+	return fmt.Sprintf("[%04d] %s %s %s", index+1, g.Bay((BAY)(index/6)), g.Side((LMR)((index/2)%3)), g.Depth((FB)(index%2)))
+}
+
+// metaFor returns the META block of parameters, creating it if needed.
+func metaFor(parameters *PARAMETERS) *models.META {
+	if parameters.META == nil {
+		parameters.META = &models.META{}
+	}
+	return parameters.META
 }
 
-func calcZerosFactors(adv, ad0 *matrix.Matrix, parameters *PARAMETERS) string {
+// calcZerosFactors solves the factors from the placement readings adv and the
+// zero readings ad0. rowWeights (nil for an ordinary fit) weighs each
+// placement step in a weighted least squares fit.
+func calcZerosFactors(adv, ad0 *matrix.Matrix, rowWeights *matrix.Vector, parameters *PARAMETERS) CalibrationResult {
 	debug := "\n"
 	add := adv.Sub(ad0)
-	w := matrix.NewVectorWithValue(adv.Rows, float64(parameters.WEIGHT))
-	adi := add.InverseSVD()
-	if adi == nil {
-		log.Fatal("SVD failed; cannot compute pseudoinverse")
+	// Steps without load would drag the fit towards zero factors
+	dropped := emptySteps(adv, add)
+	if len(dropped) > 0 {
+		names := make([]string, len(dropped))
+		for i, step := range dropped {
+			names[i] = stepName(step, parameters.GEOMETRY)
+		}
+		if !parameters.ALLOWPARTIAL {
+			log.Fatalf("Missing/empty steps (no load recorded): %s; repeat the calibration or set ALLOWPARTIAL to leave them out", strings.Join(names, ", "))
+		}
+		ui.Warningf("Warning: leaving out missing/empty steps: %s\n", strings.Join(names, ", "))
+		adv, ad0, add = adv.WithoutRows(dropped), ad0.WithoutRows(dropped), add.WithoutRows(dropped)
+		if rowWeights != nil {
+			rowWeights = rowWeights.Without(dropped)
+		}
+	}
+	w := matrix.NewVectorWithValue(adv.Rows, parameters.WEIGHT)
+	// The fit runs on the weighted system; norms are reported on the plain one
+	solveA, solveW := add, w
+	if rowWeights != nil {
+		var err error
+		solveA, solveW, err = matrix.WeightRows(add, w, rowWeights)
+		if err != nil {
+			log.Fatalf("Cannot weight the placement steps: %v", err)
+		}
+		for i, rw := range rowWeights.Values {
+			ui.Debugf(parameters.DEBUG, "Step %04d weight %.3f\n", i+1, rw)
+		}
+	}
+	adi, svdInfo, err := solveA.PseudoInverse()
+	if err != nil {
+		log.Fatalf("Cannot compute the pseudoinverse: %v", err)
 	}
 
 	// Solve f = A^+ * W
-	factors := adi.MulVector(w)
+	factors := adi.MulVector(solveW)
 	if factors == nil {
 		log.Fatal("pseudoinverse multiplication failed")
 	}
+	plainFactors := factors
+	// Optional ridge damping, scaled by the largest singular value
+	lambda := 0.0
+	if parameters.REGULARIZATION > 0 {
+		lambda = parameters.REGULARIZATION * svdInfo.Values[0]
+		adi, _, err = solveA.PseudoInverseRidge(lambda)
+		if err != nil {
+			log.Fatalf("Cannot compute the regularized pseudoinverse: %v", err)
+		}
+		factors = adi.MulVector(solveW)
+	}
 
 	// Zeros are first row of ad0
 	zeros := ad0.GetRow(0)
-	file.RecordData(debug, zeros, "Zeros", "%10.0f")
+	debug = file.RecordData(debug, zeros, "Zeros", "%10.0f")
 	// Print only IEEE754-formatted factors block (no separate decimal-only list)
 	matrix.PrintFactorsIEEE(factors)
 
+	// One scratch vector serves both residuals; check is kept for the debug dump
+	resid := matrix.NewVector(add.Rows)
+	plainNorm := add.MulVectorInto(resid, plainFactors).SubInto(resid, w).Norm() / parameters.WEIGHT
+	check := add.MulVector(factors)
+	norm := check.SubInto(resid, w).Norm() / parameters.WEIGHT
+	pinvNorm := adi.Norm()
+	if lambda > 0 {
+		ui.Greenf("Regularization lambda=%.3g: error %e (unregularized %e)\n", lambda, norm, plainNorm)
+	}
 	if parameters.DEBUG {
 		// Yellow color for debug diagnostics block
 		fmt.Print("\033[33m")
-		check := add.MulVector(factors)
 		// Show check with only one digit after the decimal point
-		file.RecordData(debug, check, "Check", "%8.1f")
+		debug = file.RecordData(debug, check, "Check", "%8.1f")
 		fmt.Println(matrix.MatrixLine)
-		norm := check.Sub(w).Norm() / float64(parameters.WEIGHT)
 		// Print diagnostics in yellow (debug-only)
 		fmt.Print("\033[33m")
 		fmt.Printf("Error: %e\n", norm)
 		debug += fmt.Sprintf("Error,%e\n", norm)
+		for _, m := range []struct {
+			title string
+			m     *matrix.Matrix
+		}{{"ZeroMatrix", ad0}, {"WeightMatrix", adv}, {"DifferenceMatrix", add}} {
+			_, csv := m.m.ToStrings(m.title, "")
+			debug += csv + "\n"
+		}
 		fmt.Println(matrix.MatrixLine)
 
-		fmt.Printf("Pseudoinverse Norm: %e\n", adi.Norm())
-		debug += fmt.Sprintf("PseudoinverseNorm,%e\n", adi.Norm())
+		fmt.Printf("Pseudoinverse Norm: %e\n", pinvNorm)
+		debug += fmt.Sprintf("PseudoinverseNorm,%e\n", pinvNorm)
+		fmt.Println(matrix.MatrixLine)
+
+		fmt.Printf("Condition Number: %e (rank %d of %d)\n", svdInfo.Condition, svdInfo.Rank, len(svdInfo.Values))
+		debug += fmt.Sprintf("ConditionNumber,%e\n", svdInfo.Condition)
+		if lambda > 0 {
+			debug += fmt.Sprintf("Lambda,%e\nUnregularizedError,%e\n", lambda, plainNorm)
+		}
 		fmt.Println(matrix.MatrixLine)
 		fmt.Print("\033[0m")
 		// Reset color after debug block
@@ -319,22 +468,26 @@ func calcZerosFactors(adv, ad0 *matrix.Matrix, parameters *PARAMETERS) string {
 		debug += matrix.MatrixLine + "\n"
 	}
 
-	nbars := len(parameters.BARS)
-	nlcs := zeros.Length / nbars
-
-	for i := 0; i < nbars; i++ {
+	// Columns hold the active load cells of each bar in order
+	index := 0
+	for i := range parameters.BARS {
+		nlcs := models.ActiveLCs(parameters.BARS[i].LCS)
+		old := parameters.BARS[i].LC
 		parameters.BARS[i].LC = make([]*LC, nlcs)
-		for j := 0; j < nlcs; j++ {
-			index := i*nlcs + j
+		for j := 0; j < nlcs; j, index = j+1, index+1 {
 			lc := &LC{
-				ZERO:   uint64(zeros.Values[index]),
+				ZERO:   zeros.Values[index],
 				FACTOR: float32(factors.Values[index]),
-				IEEE:   fmt.Sprintf("%08X", matrix.ToIEEE754(float32(factors.Values[index]))),
+				IEEE:   matrix.FormatIEEEHex(float32(factors.Values[index])),
+				LABEL:  lcLabel(old, j),
 			}
 			parameters.BARS[i].LC[j] = lc
 		}
 	}
-	return debug
+	if svdInfo.Condition > conditionWarning {
+		ui.Warningf("Warning: placement data is ill-conditioned (condition number %.3g, rank %d of %d); check that each step used the requested position\n", svdInfo.Condition, svdInfo.Rank, len(svdInfo.Values))
+	}
+	return CalibrationResult{Debug: debug, ErrorNorm: norm, PinvNorm: pinvNorm, Condition: svdInfo.Condition, Lambda: lambda, PlainErrorNorm: plainNorm, Dropped: dropped}
 }
 
 func ProbeVersion(bars *serialpkg.Leo485, parameters *PARAMETERS) bool {
@@ -342,6 +495,77 @@ func ProbeVersion(bars *serialpkg.Leo485, parameters *PARAMETERS) bool {
 	return err == nil
 }
 
+// BarVersion is the firmware version check of one bar.
+type BarVersion struct {
+	Bar     int      // 1-based bar number
+	Version *VERSION // nil when the bar did not answer
+	Err     error
+	IDOK    bool // the ID matches VERSION.ID (or none is expected)
+	Match   bool // ID, MAJOR and MINOR match VERSION and the firmware is at least MINVERSION
+}
+
+// VersionReport is the outcome of CheckVersions.
+type VersionReport struct {
+	Bars     []BarVersion
+	Warnings []string
+}
+
+// CheckVersions queries the version of every bar and compares it with the
+// optional VERSION (exact; zero fields are not checked) and MINVERSION
+// (lowest accepted MAJOR.MINOR) of parameters. Mismatches are listed in
+// Warnings; an error is only returned when no bar answered.
+func CheckVersions(bars *serialpkg.Leo485, parameters *PARAMETERS) (*VersionReport, error) {
+	expected := parameters.VERSION
+	if expected == nil {
+		expected = &VERSION{}
+	}
+	report := &VersionReport{Bars: make([]BarVersion, len(bars.Bars))}
+	answered := 0
+	for i := range bars.Bars {
+		bv := BarVersion{Bar: i + 1}
+		id, major, minor, err := bars.GetVersion(i)
+		if err != nil {
+			bv.Err = err
+			report.Warnings = append(report.Warnings, fmt.Sprintf("Bar %d: no version reply: %v", i+1, err))
+			report.Bars[i] = bv
+			continue
+		}
+		answered++
+		bv.Version = &VERSION{ID: id, MAJOR: major, MINOR: minor}
+		bv.IDOK = expected.ID == 0 || id == expected.ID
+		bv.Match = bv.IDOK
+		if !bv.IDOK {
+			report.Warnings = append(report.Warnings, fmt.Sprintf("Bar %d: version ID %d, expected %d", i+1, id, expected.ID))
+		}
+		if (expected.MAJOR != 0 && major != expected.MAJOR) || (expected.MINOR != 0 && minor != expected.MINOR) {
+			bv.Match = false
+			report.Warnings = append(report.Warnings, fmt.Sprintf("Bar %d: version %d.%d, expected %d.%d", i+1, major, minor, expected.MAJOR, expected.MINOR))
+		}
+		if min := parameters.MINVERSION; min != nil && (major < min.MAJOR || (major == min.MAJOR && minor < min.MINOR)) {
+			bv.Match = false
+			report.Warnings = append(report.Warnings, fmt.Sprintf("Bar %d: version %d.%d is older than the minimum %d.%d", i+1, major, minor, min.MAJOR, min.MINOR))
+		}
+		report.Bars[i] = bv
+		time.Sleep(200 * time.Millisecond)
+	}
+	if answered == 0 && len(bars.Bars) > 0 {
+		return report, errors.New("no bar answered the version query")
+	}
+	return report, nil
+}
+
+// warnVersions runs CheckVersions and prints its warnings; it never stops the
+// caller.
+func warnVersions(bars *serialpkg.Leo485, parameters *PARAMETERS) {
+	report, err := CheckVersions(bars, parameters)
+	for _, w := range report.Warnings {
+		ui.Warningf("Warning: %s\n", w)
+	}
+	if err != nil {
+		ui.Warningf("Warning: version check failed: %v\n", err)
+	}
+}
+
 func checkVersion(bars *serialpkg.Leo485, parameters *PARAMETERS) bool {
 	// If no VERSION section in JSON, skip validation and just discover current version
 	if parameters.VERSION == nil {
@@ -355,17 +579,21 @@ func checkVersion(bars *serialpkg.Leo485, parameters *PARAMETERS) bool {
 
 	var firstID, firstMajor, firstMinor int
 	anyError := false
+	// Per-bar firmware versions for the calibrated file's META block (nil for silent bars)
+	firmware := make([]*VERSION, len(bars.Bars))
 
-	for i := range bars.Bars {
-		id, major, minor, e := bars.GetVersion(i)
-		if e != nil {
-			log.Printf("Bar %d: version probe error: %v", i+1, e)
+	report, _ := CheckVersions(bars, parameters)
+	for i, bv := range report.Bars {
+		if bv.Err != nil {
+			log.Printf("Bar %d: version probe error: %v", i+1, bv.Err)
 			anyError = true
 			continue
 		}
+		firmware[i] = bv.Version
+		id, major, minor := bv.Version.ID, bv.Version.MAJOR, bv.Version.MINOR
 
 		// Print discovered version info with coloring for clarity
-		if expectedID != 0 && id != expectedID {
+		if !bv.IDOK {
 			log.Printf("\033[31mBar %d: Unexpected Version ID %d (expected %d)\033[0m", i+1, id, expectedID)
 			anyError = true
 		} else if expectedMajor != 0 && major != expectedMajor {
@@ -374,6 +602,9 @@ func checkVersion(bars *serialpkg.Leo485, parameters *PARAMETERS) bool {
 		} else if expectedMinor != 0 && minor != expectedMinor {
 			ui.Greenf("Bar %d: Version minor %d (expected %d)\n", i+1, minor, expectedMinor)
 			// non-fatal
+		} else if !bv.Match {
+			ui.Warningf("Bar %d: Version %d.%d is older than the minimum %d.%d\n", i+1, major, minor, parameters.MINVERSION.MAJOR, parameters.MINVERSION.MINOR)
+			// non-fatal
 		} else {
 			if expectedID == 0 && expectedMajor == 0 && expectedMinor == 0 {
 				// No expectations set, just show discovered version
@@ -388,8 +619,6 @@ func checkVersion(bars *serialpkg.Leo485, parameters *PARAMETERS) bool {
 			firstMajor = major
 			firstMinor = minor
 		}
-
-		time.Sleep(200 * time.Millisecond)
 	}
 
 	// Store discovered version in parameters if available
@@ -401,33 +630,30 @@ func checkVersion(bars *serialpkg.Leo485, parameters *PARAMETERS) bool {
 		parameters.VERSION.MAJOR = firstMajor
 		parameters.VERSION.MINOR = firstMinor
 	}
+	metaFor(parameters).FIRMWARE = firmware
 
 	return !anyError
 }
 
-func updateMatrixZero(ads []int64, calibs, nlcs int) *matrix.Matrix {
+// updateMatrixZero repeats the zero readings ads (all load cells of all bars
+// in order) on each of rows rows.
+func updateMatrixZero(ads []int64, rows int) *matrix.Matrix {
 	ad := matrix.NewVector(len(ads))
 	for i, v := range ads {
 		ad.Values[i] = float64(v)
 	}
 
 	// Suppress extra right-side marker in batch output
-	nbars := len(ads) / nlcs
-	ad0 := matrix.NewMatrix(calibs*nlcs, nbars*nlcs)
-	for i := 0; i < calibs*nlcs; i++ {
-		ad0.SetRow(i, ad)
-	}
+	ad0 := matrix.NewMatrix(rows, len(ads))
+	ad0.SetAllRows(ad)
 	return ad0
 }
 
-func updateMatrixWeight(adc *matrix.Matrix, ads []int64, index, nlcs int) *matrix.Matrix {
+// updateMatrixWeight stores the readings ads of placement index as row index.
+func updateMatrixWeight(adc *matrix.Matrix, ads []int64, index int) *matrix.Matrix {
 	// Suppress extra right-side stage number; left side shows it via interactive label
-	nbars := len(ads) / nlcs
-	for j := 0; j < nbars; j++ {
-		for i := 0; i < nlcs; i++ {
-			curr := j*nlcs + i
-			adc.Values[index][curr] = float64(ads[curr])
-		}
+	for curr := range ads {
+		adc.Values[index][curr] = float64(ads[curr])
 	}
 	return adc
 }
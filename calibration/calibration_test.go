@@ -0,0 +1,313 @@
+package calibration
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"math/rand"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/CK6170/Calrunrilla-go/matrix"
+)
+
+// mixedBars is a 4-cell main bar with a 2-cell extension.
+func mixedBars() []*BAR {
+	return []*BAR{{ID: 1, LCS: 0x0F}, {ID: 2, LCS: 0x03}}
+}
+
+// mixedFactors are plausible factors for the load cells of mixedBars.
+var mixedFactors = []float64{0.011, 0.012, 0.0105, 0.0098, 0.021, 0.019}
+
+// placements returns zero readings and one placement row per calibration
+// step for bars with lcsPerBar load cells, where every step puts exactly
+// weight on the shelf as seen through factors.
+func placements(lcsPerBar []int, factors []float64, weight float64) (adv, ad0 *matrix.Matrix) {
+	maxn := 0
+	for _, n := range lcsPerBar {
+		maxn = max(maxn, n)
+	}
+	rows := 3 * (len(lcsPerBar) - 1) * maxn
+	rng := rand.New(rand.NewSource(1))
+	zeros := make([]int64, len(factors))
+	for c := range zeros {
+		zeros[c] = 100000 + rng.Int63n(50000)
+	}
+	ad0 = updateMatrixZero(zeros, rows)
+	adv = matrix.NewMatrix(rows, len(factors))
+	for r := 0; r < rows; r++ {
+		load := make([]float64, len(factors))
+		seen := 0.0
+		for c := range load {
+			load[c] = 0.1 + rng.Float64()
+			seen += load[c] * factors[c]
+		}
+		for c := range load {
+			adv.Values[r][c] = float64(zeros[c]) + load[c]*weight/seen
+		}
+	}
+	return adv, ad0
+}
+
+// assertFactors checks the factors stored on bars against want, in order.
+func assertFactors(t *testing.T, bars []*BAR, want []float64) {
+	t.Helper()
+	k := 0
+	for i, bar := range bars {
+		for j, lc := range bar.LC {
+			if k >= len(want) {
+				t.Fatalf("more load cells than the %d factors expected", len(want))
+			}
+			if got := float64(lc.FACTOR); math.Abs(got-want[k]) > 1e-6*math.Abs(want[k]) {
+				t.Errorf("bar %d LC %d factor = %g, want %g", i+1, j+1, got, want[k])
+			}
+			k++
+		}
+	}
+	if k != len(want) {
+		t.Errorf("%d load cells, want %d", k, len(want))
+	}
+}
+
+func TestCalcZerosFactorsMixedBars(t *testing.T) {
+	parameters := &PARAMETERS{WEIGHT: 500, BARS: mixedBars()}
+	adv, ad0 := placements([]int{4, 2}, mixedFactors, parameters.WEIGHT)
+	if adv.Rows != 12 || adv.Cols != 6 {
+		t.Fatalf("plan is %dx%d, want 12x6", adv.Rows, adv.Cols)
+	}
+
+	result := calcZerosFactors(adv, ad0, nil, parameters)
+	if result.ErrorNorm > 1e-9 {
+		t.Errorf("ErrorNorm = %g on exact data", result.ErrorNorm)
+	}
+	if n := len(parameters.BARS[0].LC); n != 4 {
+		t.Errorf("bar 1 has %d LCs, want 4", n)
+	}
+	if n := len(parameters.BARS[1].LC); n != 2 {
+		t.Errorf("bar 2 has %d LCs, want 2", n)
+	}
+	assertFactors(t, parameters.BARS, mixedFactors)
+	// each LC keeps the zero of its own column
+	if got, want := parameters.BARS[1].LC[0].ZERO, ad0.Values[0][4]; got != want {
+		t.Errorf("bar 2 LC 1 zero = %g, want %g", got, want)
+	}
+}
+
+func TestIntegerWeightConfig(t *testing.T) {
+	const bars = `"BARS": [{"ID": 1, "LCS": 15}, {"ID": 2, "LCS": 3}]`
+	var integer, float PARAMETERS
+	if err := json.Unmarshal([]byte(`{"WEIGHT": 500, `+bars+`}`), &integer); err != nil {
+		t.Fatalf("integer WEIGHT: %v", err)
+	}
+	if err := json.Unmarshal([]byte(`{"WEIGHT": 500.0, `+bars+`}`), &float); err != nil {
+		t.Fatalf("float WEIGHT: %v", err)
+	}
+	if integer.WEIGHT != 500 {
+		t.Fatalf("WEIGHT = %g, want 500", integer.WEIGHT)
+	}
+
+	adv, ad0 := placements([]int{4, 2}, mixedFactors, 500)
+	calcZerosFactors(adv, ad0, nil, &integer)
+	calcZerosFactors(adv, ad0, nil, &float)
+	for i := range integer.BARS {
+		for j := range integer.BARS[i].LC {
+			if a, b := integer.BARS[i].LC[j], float.BARS[i].LC[j]; a.FACTOR != b.FACTOR || a.IEEE != b.IEEE {
+				t.Errorf("bar %d LC %d: factor %s from an integer WEIGHT, %s from a float one", i+1, j+1, a.IEEE, b.IEEE)
+			}
+		}
+	}
+	assertFactors(t, integer.BARS, mixedFactors)
+
+	// integer weights still read as before in the prompts
+	for w, want := range map[float64]string{500: "500", 22.68: "22.68"} {
+		if got := formatWeight(w); got != want {
+			t.Errorf("formatWeight(%g) = %q, want %q", w, got, want)
+		}
+	}
+}
+
+func TestSplitPerBarRagged(t *testing.T) {
+	got := splitPerBar([]int64{1, 2, 3, 4, 5, 6}, []int{4, 2})
+	if want := [][]int64{{1, 2, 3, 4}, {5, 6}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("splitPerBar = %v, want %v", got, want)
+	}
+	// a short reading leaves the missing load cells at zero
+	got = splitPerBar([]int64{1, 2, 3, 4, 5}, []int{2, 4})
+	if want := [][]int64{{1, 2}, {3, 4, 5, 0}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("splitPerBar short = %v, want %v", got, want)
+	}
+}
+
+func TestCalculateFinalAveragesRagged(t *testing.T) {
+	samples := [][][]int64{
+		{{10, 20, 30, 40}, {12, 22, 32, 42}},
+		{{100, 200}, {104, 204}},
+	}
+	got := calculateFinalAverages(samples, []int{4, 2})
+	if want := [][]int64{{11, 21, 31, 41}, {102, 202}}; !reflect.DeepEqual(got, want) {
+		t.Errorf("calculateFinalAverages = %v, want %v", got, want)
+	}
+}
+
+// sampleMath loads the adv/ad0 matrices from the math.json sample at the
+// repository root: ITER0 holds the zeros and ITER1.. the placements of two
+// bars with two load cells each.
+func sampleMath(t *testing.T) (adv, ad0 *matrix.Matrix, weight float64) {
+	t.Helper()
+	data, err := os.ReadFile(filepath.Join("..", "math.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var raw struct {
+		WEIGHT float64
+		ITER0  []struct{ LC []float64 }
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		t.Fatal(err)
+	}
+	var iters map[string]json.RawMessage
+	if err := json.Unmarshal(data, &iters); err != nil {
+		t.Fatal(err)
+	}
+	var zeros []float64
+	for _, bar := range raw.ITER0 {
+		zeros = append(zeros, bar.LC...)
+	}
+	rows := 0
+	for iters[fmt.Sprintf("ITER%d", rows+1)] != nil {
+		rows++
+	}
+	adv = matrix.NewMatrix(rows, len(zeros))
+	for r := 0; r < rows; r++ {
+		var bars []struct{ LC []float64 }
+		if err := json.Unmarshal(iters[fmt.Sprintf("ITER%d", r+1)], &bars); err != nil {
+			t.Fatal(err)
+		}
+		c := 0
+		for _, bar := range bars {
+			c += copy(adv.Values[r][c:], bar.LC)
+		}
+	}
+	ad0 = matrix.NewMatrix(rows, len(zeros))
+	ad0.SetAllRows(&matrix.Vector{Length: len(zeros), Values: zeros})
+	return adv, ad0, raw.WEIGHT
+}
+
+func TestUniformRowWeightsMatchPlainFit(t *testing.T) {
+	noisyAdv, noisyAd0 := placements([]int{4, 2}, mixedFactors, 500)
+	rng := rand.New(rand.NewSource(2))
+	for i := range noisyAdv.Values {
+		for j := range noisyAdv.Values[i] {
+			noisyAdv.Values[i][j] += rng.NormFloat64() * 20
+		}
+	}
+	sampleAdv, sampleAd0, sampleWeight := sampleMath(t)
+	for _, tc := range []struct {
+		name     string
+		adv, ad0 *matrix.Matrix
+		weight   float64
+		bars     func() []*BAR
+	}{
+		{"math.json", sampleAdv, sampleAd0, sampleWeight, func() []*BAR { return []*BAR{{ID: 1, LCS: 0x03}, {ID: 2, LCS: 0x03}} }},
+		{"noisy", noisyAdv, noisyAd0, 500, mixedBars},
+	} {
+		plain := &PARAMETERS{WEIGHT: tc.weight, BARS: tc.bars()}
+		weighted := &PARAMETERS{WEIGHT: tc.weight, BARS: tc.bars()}
+		calcZerosFactors(tc.adv, tc.ad0, nil, plain)
+		calcZerosFactors(tc.adv, tc.ad0, matrix.NewVectorWithValue(tc.adv.Rows, 1), weighted)
+		for i := range plain.BARS {
+			for j := range plain.BARS[i].LC {
+				if a, b := plain.BARS[i].LC[j], weighted.BARS[i].LC[j]; *a != *b {
+					t.Errorf("%s: bar %d LC %d is %+v with unit weights, %+v without", tc.name, i+1, j+1, *b, *a)
+				}
+			}
+		}
+		if tc.name == "math.json" {
+			// every placement reads 2e6 counts per 1000 on the loaded cells
+			assertFactors(t, plain.BARS, []float64{5e-4, 5e-4, 5e-4, 5e-4})
+		}
+	}
+}
+
+func TestTruncatedMeans(t *testing.T) {
+	got := truncatedMeans([][]int64{{1, 2}, {1, 1, 2}, nil, {150000001, 150000002, 150000002}, {-1, -2}, {3, 3, 3, 4}})
+	if want := []int64{1, 1, 0, 150000001, -1, 3}; !reflect.DeepEqual(got, want) {
+		t.Errorf("truncatedMeans = %v, want %v", got, want)
+	}
+}
+
+// withMissingSteps returns placement data in which step 3 never recorded a
+// reading and step 6 recorded no load; the other steps fit mixedFactors.
+func withMissingSteps() (adv, ad0 *matrix.Matrix) {
+	adv, ad0 = placements([]int{4, 2}, mixedFactors, 500)
+	clear(adv.Values[2])
+	copy(adv.Values[5], ad0.Values[5])
+	return adv, ad0
+}
+
+func TestEmptySteps(t *testing.T) {
+	adv, ad0 := withMissingSteps()
+	if got := emptySteps(adv, adv.Sub(ad0)); !reflect.DeepEqual(got, []int{2, 5}) {
+		t.Errorf("emptySteps = %v, want [2 5]", got)
+	}
+	full, ad0 := placements([]int{4, 2}, mixedFactors, 500)
+	if got := emptySteps(full, full.Sub(ad0)); got != nil {
+		t.Errorf("emptySteps on complete data = %v", got)
+	}
+}
+
+func TestEmptyStepsMostlyEmpty(t *testing.T) {
+	// 8 of 12 steps read the zeros plus a few counts of noise, so the median
+	// step is empty
+	adv, ad0 := placements([]int{4, 2}, mixedFactors, 500)
+	rng := rand.New(rand.NewSource(2))
+	want := []int{0, 1, 3, 4, 6, 8, 9, 11}
+	for _, r := range want {
+		for c := range adv.Values[r] {
+			adv.Values[r][c] = ad0.Values[r][c] + float64(rng.Intn(7)-3)
+		}
+	}
+	if got := emptySteps(adv, adv.Sub(ad0)); !reflect.DeepEqual(got, want) {
+		t.Errorf("emptySteps = %v, want %v", got, want)
+	}
+	// steps reading exactly the zeros are empty with no loaded step left
+	if got := emptySteps(ad0, ad0.Sub(ad0)); len(got) != ad0.Rows {
+		t.Errorf("emptySteps with no load = %v, want all %d steps", got, ad0.Rows)
+	}
+}
+
+func TestCalcZerosFactorsAllowPartial(t *testing.T) {
+	adv, ad0 := withMissingSteps()
+	parameters := &PARAMETERS{WEIGHT: 500, ALLOWPARTIAL: true, BARS: mixedBars()}
+	// the weights are dropped along with their steps
+	result := calcZerosFactors(adv, ad0, matrix.NewVectorWithValue(adv.Rows, 1), parameters)
+	if !reflect.DeepEqual(result.Dropped, []int{2, 5}) {
+		t.Errorf("Dropped = %v, want [2 5]", result.Dropped)
+	}
+	if result.ErrorNorm > 1e-9 {
+		t.Errorf("ErrorNorm = %g once the empty steps are left out", result.ErrorNorm)
+	}
+	assertFactors(t, parameters.BARS, mixedFactors)
+}
+
+func TestCalcZerosFactorsRefusesMissingSteps(t *testing.T) {
+	// without ALLOWPARTIAL calcZerosFactors exits, so run it in a child process
+	if os.Getenv("CALRUNRILLA_MISSING_STEPS") == "1" {
+		adv, ad0 := withMissingSteps()
+		calcZerosFactors(adv, ad0, nil, &PARAMETERS{WEIGHT: 500, BARS: mixedBars()})
+		return
+	}
+	cmd := exec.Command(os.Args[0], "-test.run=^TestCalcZerosFactorsRefusesMissingSteps$")
+	cmd.Env = append(os.Environ(), "CALRUNRILLA_MISSING_STEPS=1")
+	out, err := cmd.CombinedOutput()
+	if err == nil {
+		t.Fatal("missing steps accepted without ALLOWPARTIAL")
+	}
+	if !strings.Contains(string(out), "Missing/empty steps") || !strings.Contains(string(out), "[0003]") || !strings.Contains(string(out), "[0006]") {
+		t.Errorf("unexpected output:\n%s", out)
+	}
+}
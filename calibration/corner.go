@@ -0,0 +1,243 @@
+package calibration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"time"
+
+	file "github.com/CK6170/Calrunrilla-go/file"
+	models "github.com/CK6170/Calrunrilla-go/models"
+	serialpkg "github.com/CK6170/Calrunrilla-go/serial"
+	"github.com/CK6170/Calrunrilla-go/ui"
+)
+
+// CornerPosition is one placement of the corner test and, once sampled, its
+// result.
+type CornerPosition struct {
+	INDEX     int     `json:"INDEX"`
+	BAY       string  `json:"BAY"`
+	SIDE      string  `json:"SIDE"`
+	DEPTH     string  `json:"DEPTH"`
+	MEASURED  float64 `json:"MEASURED"`
+	DEVIATION float64 `json:"DEVIATION"` // MEASURED - WEIGHT
+	PASS      bool    `json:"PASS"`
+}
+
+// CornerTestReport is the outcome of RunCornerTest.
+type CornerTestReport struct {
+	CREATED   string            `json:"CREATED"`
+	PORT      string            `json:"PORT,omitempty"`
+	WEIGHT    float64           `json:"WEIGHT"`
+	TOLERANCE float64           `json:"TOLERANCE"`
+	POSITIONS []*CornerPosition `json:"POSITIONS"`
+	PASS      bool              `json:"PASS"`
+}
+
+// CornerStep is handed to the RunCornerTest callback before each sampling.
+// Position is nil for the initial step, where the bays must be cleared so the
+// zeros can be collected.
+type CornerStep struct {
+	Index    int // 0 for the zero step, then 1..Total
+	Total    int
+	Prompt   string
+	Position *CornerPosition
+}
+
+// cornerPositions lists the placements of the corner test: every
+// LEFT/MIDDLE/RIGHT x FRONT/BACK position of each bay, in the order used by
+// weightCalibration but without repeating positions per load cell, named
+// after g (which may be nil).
+func cornerPositions(nbars int, g *models.GEOMETRY) []*CornerPosition {
+	n := 6 * (nbars - 1)
+	positions := make([]*CornerPosition, 0, n)
+	for i := 0; i < n; i++ {
+		positions = append(positions, &CornerPosition{
+			INDEX: i + 1,
+			BAY:   g.Bay(BAY(i / 6)),
+			SIDE:  g.Side(LMR((i / 2) % 3)),
+			DEPTH: g.Depth(FB(i % 2)),
+		})
+	}
+	return positions
+}
+
+// cornerTolerance returns the configured corner test tolerance for weight.
+func cornerTolerance(parameters *PARAMETERS, weight float64) float64 {
+	if parameters.TEST != nil && parameters.TEST.CORNERTOL > 0 {
+		return parameters.TEST.CORNERTOL
+	}
+	return weight / 100
+}
+
+// sampleGrandTotal discards IGNORE snapshots and returns the mean grand total
+// of the next AVG snapshots in which every bar answered.
+func sampleGrandTotal(ctx context.Context, bars *serialpkg.Leo485, zerosPerBar [][]int64, parameters *PARAMETERS) (float64, error) {
+	ignore, avg := parameters.IGNORE, parameters.AVG
+	if avg <= 0 {
+		avg = 1
+	}
+	sum, count, failed := 0.0, 0, 0
+	for count < avg {
+		snap, err := ComputeTestSnapshot(ctx, bars, zerosPerBar, parameters)
+		if err != nil {
+			return 0, err
+		}
+		complete := true
+		for i, ok := range snap.PerBarOK {
+			if !ok {
+				complete = false
+				failed++
+				if failed > 3*(ignore+avg) {
+					return 0, fmt.Errorf("bar %d does not answer: %v", i+1, snap.Errors[i])
+				}
+				break
+			}
+		}
+		if !complete {
+			continue
+		}
+		if ignore > 0 {
+			ignore--
+			continue
+		}
+		sum += snap.GrandTotal
+		count++
+	}
+	return sum / float64(count), nil
+}
+
+// RunCornerTest checks that weight placed at each bay position reads within
+// tolerance. onStep is called before the zeros are collected and before each
+// position is sampled; it must return once the operator is ready, or an error
+// to abort the test. The report is returned with every position sampled so far.
+func RunCornerTest(ctx context.Context, bars *serialpkg.Leo485, parameters *PARAMETERS, weight float64, tolerance float64, onStep func(CornerStep) error) (*CornerTestReport, error) {
+	nbars := len(parameters.BARS)
+	if nbars < 2 {
+		return nil, errors.New("the corner test needs at least two bars")
+	}
+	report := &CornerTestReport{
+		CREATED:   time.Now().Format(time.RFC3339),
+		WEIGHT:    weight,
+		TOLERANCE: tolerance,
+		POSITIONS: cornerPositions(nbars, parameters.GEOMETRY),
+	}
+	if parameters.SERIAL != nil {
+		report.PORT = parameters.SERIAL.PORT
+	}
+	total := len(report.POSITIONS)
+	if err := onStep(CornerStep{Total: total, Prompt: zeromsg}); err != nil {
+		return report, err
+	}
+	zerosPerBar := splitPerBar(collectAveragedZeros(bars, parameters, parameters.AVG, nil), bars.LCsPerBar())
+
+	report.PASS = true
+	for i, pos := range report.POSITIONS {
+		prompt := fmt.Sprintf(calibmsg, formatWeight(weight), pos.BAY, pos.SIDE, pos.DEPTH, shelfName(parameters))
+		if err := onStep(CornerStep{Index: i + 1, Total: total, Prompt: prompt, Position: pos}); err != nil {
+			report.POSITIONS = report.POSITIONS[:i]
+			report.PASS = false
+			return report, err
+		}
+		measured, err := sampleGrandTotal(ctx, bars, zerosPerBar, parameters)
+		if err != nil {
+			report.POSITIONS = report.POSITIONS[:i]
+			report.PASS = false
+			return report, err
+		}
+		pos.MEASURED = measured
+		pos.DEVIATION = measured - weight
+		pos.PASS = math.Abs(pos.DEVIATION) <= tolerance
+		report.PASS = report.PASS && pos.PASS
+	}
+	return report, nil
+}
+
+// errCancelled is returned by the interactive step prompts on <ESC>.
+var errCancelled = errors.New("process cancelled")
+
+// waitForContinue prints prompt in green and waits for 'C' (nil) or <ESC>.
+func waitForContinue(prompt string) error {
+	ui.Greenf("%s\n", prompt)
+	ui.DrainKeys()
+	keyEvents := ui.StartKeyEvents()
+	for {
+		k, ok := <-keyEvents
+		if !ok || k == 27 {
+			return errCancelled
+		}
+		if k == 'C' || k == 'c' {
+			return nil
+		}
+	}
+}
+
+// CornerTestConfig loads parameters from a config, runs the interactive corner
+// test with WEIGHT and saves the report as <name>_corner_<timestamp>.json.
+func CornerTestConfig(configPath string) {
+	loaded, err := file.LoadParameters(configPath)
+	if err != nil {
+		log.Fatalf("Invalid config %s:\n%v", configPath, err)
+	}
+	parameters := *loaded
+	if parameters.IGNORE <= 0 {
+		parameters.IGNORE = parameters.AVG
+	}
+	bars, err := ConnectWithRecovery(configPath, &parameters, false, printStatus)
+	if err != nil {
+		log.Fatalf("Cannot connect to the bars: %v", err)
+	}
+	defer func() { _ = bars.Close() }()
+	warnVersions(bars, &parameters)
+	factorSrc, err := EnsureFactorsFromDevice(bars, &parameters)
+	if err != nil {
+		log.Fatalf("Cannot read the factors from the bars: %v", err)
+	}
+	ui.Debugf(parameters.DEBUG, "Using factors from %s\n", factorSrc)
+
+	weight := parameters.WEIGHT
+	if weight <= 0 {
+		log.Fatal("The corner test needs WEIGHT in the config")
+	}
+	tolerance := cornerTolerance(&parameters, weight)
+	report, err := RunCornerTest(context.Background(), bars, &parameters, weight, tolerance, func(step CornerStep) error {
+		if step.Position != nil {
+			ui.Greenf("\nPosition %d/%d", step.Index, step.Total)
+		}
+		return waitForContinue(step.Prompt)
+	})
+	if report != nil {
+		printCornerReport(report)
+		path := fmt.Sprintf("%s_corner_%s.json", strings.TrimSuffix(configPath, ".json"), time.Now().Format("20060102-150405"))
+		if err := file.SaveReport(path, report); err != nil {
+			log.Printf("Cannot save the corner test report: %v", err)
+		} else {
+			ui.Greenf("Corner test report saved to %s\n", path)
+		}
+	}
+	if err != nil {
+		log.Fatalf("Corner test stopped: %v", err)
+	}
+}
+
+// printCornerReport prints one line per position and the overall result.
+func printCornerReport(r *CornerTestReport) {
+	fmt.Println()
+	fmt.Printf("Corner test: %s +/- %s\n", formatWeight(r.WEIGHT), formatWeight(r.TOLERANCE))
+	for _, p := range r.POSITIONS {
+		line := fmt.Sprintf("[%02d] %-7s %-6s %-5s %10.1f  %+8.1f", p.INDEX, p.BAY, p.SIDE, p.DEPTH, p.MEASURED, p.DEVIATION)
+		if p.PASS {
+			ui.Greenf("%s  PASS\n", line)
+		} else {
+			ui.Warningf("%s  FAIL\n", line)
+		}
+	}
+	if r.PASS {
+		ui.Greenf("Corner test passed\n")
+	} else {
+		ui.Warningf("Corner test failed\n")
+	}
+}
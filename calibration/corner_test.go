@@ -0,0 +1,33 @@
+package calibration
+
+import (
+	"fmt"
+	"testing"
+
+	models "github.com/CK6170/Calrunrilla-go/models"
+)
+
+func TestCornerPositionsFollowSteps(t *testing.T) {
+	g := &models.GEOMETRY{BAYS: []string{"Bay A", "Bay B"}, SIDES: []string{"L", "", "R"}}
+	positions := cornerPositions(3, g)
+	if len(positions) != 12 {
+		t.Fatalf("%d positions for 3 bars, want 12", len(positions))
+	}
+	want := []string{
+		"Bay A L FRONT", "Bay A L BACK", "Bay A MIDDLE FRONT", "Bay A MIDDLE BACK", "Bay A R FRONT", "Bay A R BACK",
+		"Bay B L FRONT", "Bay B L BACK", "Bay B MIDDLE FRONT", "Bay B MIDDLE BACK", "Bay B R FRONT", "Bay B R BACK",
+	}
+	for i, p := range positions {
+		got := p.BAY + " " + p.SIDE + " " + p.DEPTH
+		if p.INDEX != i+1 || got != want[i] {
+			t.Errorf("position %d = %d %q, want %d %q", i, p.INDEX, got, i+1, want[i])
+		}
+		// the empty-step report names the same position
+		if name := stepName(i, g); name != fmt.Sprintf("[%04d] %s", i+1, want[i]) {
+			t.Errorf("stepName(%d) = %q, want it to match %q", i, name, want[i])
+		}
+	}
+	if got := stepName(7, nil); got != "[0008] SECOND LEFT BACK" {
+		t.Errorf("stepName without GEOMETRY = %q", got)
+	}
+}
@@ -1,13 +1,12 @@
 package calibration
 
 import (
-	"encoding/json"
 	"fmt"
 	"log"
-	"os"
 	"strings"
 	"time"
 
+	file "github.com/CK6170/Calrunrilla-go/file"
 	"github.com/CK6170/Calrunrilla-go/matrix"
 	models "github.com/CK6170/Calrunrilla-go/models"
 	serialpkg "github.com/CK6170/Calrunrilla-go/serial"
@@ -15,29 +14,19 @@ import (
 )
 
 // flashOnly loads the parameters and performs a headless flash of bar parameters.
-func FlashOnly(configPath string) {
-	jsonData, err := os.ReadFile(configPath)
+func FlashOnly(configPath string, appVer string, appBuild string, opts Options) {
+	loaded, err := file.LoadParameters(configPath)
 	if err != nil {
-		log.Fatalf("Error reading file: %v", err)
+		log.Fatalf("Invalid config %s:\n%v", configPath, err)
 	}
-	var parameters models.PARAMETERS
-	if err := json.Unmarshal(jsonData, &parameters); err != nil {
-		log.Fatalf("JSON error: %v", err)
-	}
-	if parameters.SERIAL == nil {
-		log.Fatal("Missing SERIAL section in JSON")
-	}
-	if parameters.SERIAL.PORT == "" {
-		p := serialpkg.AutoDetectPort(&parameters)
-		if p == "" {
-			log.Fatal("Could not auto-detect serial port for flash")
-		}
-		parameters.SERIAL.PORT = p
+	parameters := *loaded
+	bars, err := ConnectWithRecovery(configPath, &parameters, false, printStatus)
+	if err != nil {
+		log.Fatalf("Cannot connect to the bars: %v", err)
 	}
-	bars := serialpkg.NewLeo485(parameters.SERIAL, parameters.BARS)
 	defer func() { _ = bars.Close() }()
-	if !ProbeVersion(bars, &parameters) {
-		log.Fatalf("ProbeVersion failed on %s", parameters.SERIAL.PORT)
+	if !backupBeforeFlash(bars, &parameters, configPath, appVer, appBuild, opts) {
+		log.Fatal("Flash aborted: backup before flash failed")
 	}
 	if err := flashParameters(bars, &parameters); err != nil {
 		log.Fatalf("Flash failed: %v", err)
@@ -74,7 +63,7 @@ func flashParameters(bars *serialpkg.Leo485, parameters *models.PARAMETERS) erro
 		remaining := make([]int, 0)
 		for _, idx := range notReady {
 			cmd := serialpkg.GetCommand(parameters.BARS[idx].ID, []byte(serialpkg.Euler))
-			resp, err := serialpkg.ChangeState(bars.Serial, cmd, 400)
+			resp, err := bars.ChangeState(cmd, 400)
 			if err != nil {
 				if parameters.DEBUG {
 					ui.Debugf(true, "Euler handshake bar %d attempt %d err=%v resp=%q\n", idx+1, attempt, err, resp)
@@ -109,9 +98,9 @@ func flashParameters(bars *serialpkg.Leo485, parameters *models.PARAMETERS) erro
 		ui.Debugf(true, "All bars entered update mode; sending dummy CR to bays\n")
 	}
 	// send a single CR once to prime all bootloaders
-	_, _ = bars.Serial.Write([]byte{0x0D})
-	// small read to clear any immediate reply (use lower-level readUntil)
-	_, _ = serialpkg.ReadUntil(bars.Serial, 50)
+	if err := bars.PrimeBootloaders(50); err != nil {
+		return fmt.Errorf("prime bootloaders: %v", err)
+	}
 
 	nbars := len(parameters.BARS)
 	for i := 0; i < nbars; i++ {
@@ -120,37 +109,12 @@ func flashParameters(bars *serialpkg.Leo485, parameters *models.PARAMETERS) erro
 		lcs := activeLCs(parameters.BARS[i], 4)
 		ui.Greenf(" LCS=%d\n", lcs)
 
-		nlcs := len(parameters.BARS[i].LC)
-		zero := matrix.NewVector(nlcs)
-		facs := matrix.NewVector(nlcs)
-		zeravg := 0.0
-		for j := 0; j < nlcs; j++ {
-			zero.Values[j] = float64(parameters.BARS[i].LC[j].ZERO)
-			facs.Values[j] = float64(parameters.BARS[i].LC[j].FACTOR)
-			zeravg += zero.Values[j] * facs.Values[j]
-		}
-		if zeravg < 0 {
-			zeravg = 0
-			ui.Warningf("Avg. Zero reference is negative\n")
-		}
 		ui.Greenf(" Flashing Zeros:\n")
 		// Attempt to write zeros with retries and debug logging
-		// Build the O command payload same as WriteZeros expects
-		sb := "O"
-		k := 0
-		for ii := 0; ii < 4; ii++ {
-			if (parameters.BARS[i].LCS & (1 << ii)) != 0 {
-				sb += fmt.Sprintf("%09.0f|", zero.Values[k])
-				k++
-			} else {
-				sb += fmt.Sprintf("%09d|", 0)
-			}
-		}
-		sb += fmt.Sprintf("%09d|", uint64(zeravg/float64(nlcs)+0.5))
-		zeroCmd := serialpkg.GetCommand(parameters.BARS[i].ID, []byte(sb))
+		zeroCmd := serialpkg.GetCommand(parameters.BARS[i].ID, []byte(zerosPayload(parameters.BARS[i])))
 		wroteZeros := false
 		for attempt := 1; attempt <= 3; attempt++ {
-			resp, err := serialpkg.UpdateValue(bars.Serial, zeroCmd, 200)
+			resp, err := bars.UpdateValue(zeroCmd, 200)
 			if err == nil && strings.Contains(resp, "OK") {
 				wroteZeros = true
 				if parameters.DEBUG {
@@ -169,21 +133,10 @@ func flashParameters(bars *serialpkg.Leo485, parameters *models.PARAMETERS) erro
 		}
 
 		ui.Greenf(" Flashing factors:\n")
-		// Build X command payload
-		sb2 := "X"
-		k2 := 0
-		for ii := 0; ii < 4; ii++ {
-			if (parameters.BARS[i].LCS & (1 << ii)) != 0 {
-				sb2 += fmt.Sprintf("%.10f|", facs.Values[k2])
-				k2++
-			} else {
-				sb2 += "1.0000000000|"
-			}
-		}
-		facCmd := serialpkg.GetCommand(parameters.BARS[i].ID, []byte(sb2))
+		facCmd := serialpkg.GetCommand(parameters.BARS[i].ID, []byte(factorsPayload(parameters.BARS[i])))
 		wroteFacs := false
 		for attempt := 1; attempt <= 3; attempt++ {
-			resp, err := serialpkg.UpdateValue(bars.Serial, facCmd, 200)
+			resp, err := bars.UpdateValue(facCmd, 200)
 			if err == nil && strings.Contains(resp, "OK") {
 				wroteFacs = true
 				if parameters.DEBUG {
@@ -220,3 +173,55 @@ func activeLCs(bar *models.BAR, maxLCs int) int {
 	}
 	return n
 }
+
+// zerosPayload builds the O command data, as WriteZeros expects it, that
+// flashes the zeros of bar: one field per LC slot (0 for unused slots) and
+// the average zero reference. The device stores unsigned zeros, so negative
+// ones are sent as 0 with a warning.
+func zerosPayload(bar *models.BAR) string {
+	nlcs := len(bar.LC)
+	zero := matrix.NewVector(nlcs)
+	zeravg := 0.0
+	for j := 0; j < nlcs; j++ {
+		zero.Values[j] = bar.LC[j].ZERO
+		zeravg += zero.Values[j] * float64(bar.LC[j].FACTOR)
+	}
+	if zeravg < 0 {
+		zeravg = 0
+		ui.Warningf("Avg. Zero reference is negative\n")
+	}
+	for j, z := range zero.Values {
+		if z < 0 {
+			ui.Warningf(" LC %d zero %.1f is negative; flashing 0\n", j+1, z)
+			zero.Values[j] = 0
+		}
+	}
+	sb := "O"
+	k := 0
+	for ii := 0; ii < 4; ii++ {
+		if (bar.LCS & (1 << ii)) != 0 {
+			sb += fmt.Sprintf("%09.0f|", zero.Values[k])
+			k++
+		} else {
+			sb += fmt.Sprintf("%09d|", 0)
+		}
+	}
+	sb += fmt.Sprintf("%09d|", uint64(zeravg/float64(nlcs)+0.5))
+	return sb
+}
+
+// factorsPayload builds the X command data that flashes the factors of bar,
+// 1.0 for unused LC slots.
+func factorsPayload(bar *models.BAR) string {
+	sb := "X"
+	k := 0
+	for ii := 0; ii < 4; ii++ {
+		if (bar.LCS & (1 << ii)) != 0 {
+			sb += fmt.Sprintf("%.10f|", float64(bar.LC[k].FACTOR))
+			k++
+		} else {
+			sb += "1.0000000000|"
+		}
+	}
+	return sb
+}
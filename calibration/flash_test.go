@@ -0,0 +1,80 @@
+package calibration
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/CK6170/Calrunrilla-go/file"
+)
+
+// legacyBar is a bar as stored before ZERO became a float64.
+type legacyBar struct {
+	LCS byte
+	LC  []struct {
+		ZERO   uint64
+		FACTOR float32
+	}
+}
+
+// legacyZerosPayload is the zeros payload as built from uint64 zeros.
+func legacyZerosPayload(bar legacyBar) string {
+	nlcs := len(bar.LC)
+	zeravg := 0.0
+	for _, lc := range bar.LC {
+		zeravg += float64(lc.ZERO) * float64(lc.FACTOR)
+	}
+	if zeravg < 0 {
+		zeravg = 0
+	}
+	sb := "O"
+	k := 0
+	for ii := 0; ii < 4; ii++ {
+		if (bar.LCS & (1 << ii)) != 0 {
+			sb += fmt.Sprintf("%09.0f|", float64(bar.LC[k].ZERO))
+			k++
+		} else {
+			sb += fmt.Sprintf("%09d|", 0)
+		}
+	}
+	return sb + fmt.Sprintf("%09d|", uint64(zeravg/float64(nlcs)+0.5))
+}
+
+func TestLegacyCalibratedFlashPayload(t *testing.T) {
+	path := filepath.Join("..", "test_calibrated.json")
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var legacy struct{ BARS []legacyBar }
+	if err := json.Unmarshal(data, &legacy); err != nil {
+		t.Fatalf("not an old-format file: %v", err)
+	}
+	parameters, err := file.LoadParameters(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(parameters.BARS) != len(legacy.BARS) {
+		t.Fatalf("%d bars loaded, want %d", len(parameters.BARS), len(legacy.BARS))
+	}
+	for i, bar := range parameters.BARS {
+		if got, want := zerosPayload(bar), legacyZerosPayload(legacy.BARS[i]); got != want {
+			t.Errorf("bar %d zeros payload = %q, want %q", i+1, got, want)
+		}
+	}
+	if got, want := zerosPayload(parameters.BARS[0]), "O148672864|150263175|000000000|000000000|000020988|"; got != want {
+		t.Errorf("bar 1 zeros payload = %q, want %q", got, want)
+	}
+	if got, want := factorsPayload(parameters.BARS[1]), "X0.0005265933|-0.0000475557|1.0000000000|1.0000000000|"; got != want {
+		t.Errorf("bar 2 factors payload = %q, want %q", got, want)
+	}
+}
+
+func TestNegativeZeroFlashedAsZero(t *testing.T) {
+	bar := &BAR{ID: 1, LCS: 0x05, LC: []*LC{{ZERO: -3.4, FACTOR: 0.01}, {ZERO: 1000.4, FACTOR: 0.01}}}
+	if got, want := zerosPayload(bar), "O000000000|000000000|000001000|000000000|000000005|"; got != want {
+		t.Errorf("zeros payload = %q, want %q", got, want)
+	}
+}
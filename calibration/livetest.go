@@ -0,0 +1,337 @@
+package calibration
+
+import (
+	"context"
+	"fmt"
+	"math"
+	"time"
+
+	serialpkg "github.com/CK6170/Calrunrilla-go/serial"
+)
+
+// Kinds of TestEvent emitted by RunLiveTest.
+const (
+	TestEventZeros         = "zeros"         // zeros were (re)collected; see Zeros and Rezero
+	TestEventStatus        = "status"        // human-readable progress, e.g. a reconnect attempt
+	TestEventZerosProgress = "zerosProgress" // a zero sample was taken; see Progress
+	TestEventStable        = "stable"        // the grand total settled; see Value
+	TestEventUnstable      = "unstable"      // the grand total started moving again
+	TestEventBarOffline    = "barOffline"    // a bar stopped answering; see Bar and Message
+	TestEventBarRecovered  = "barRecovered"  // an offline bar answers again; see Bar
+	TestEventOverload      = "overload"      // a total went over its capacity; see Bar and Value
+)
+
+// TestEvent reports something other than a snapshot during a live test.
+type TestEvent struct {
+	Kind     string
+	Zeros    [][]int64     // TestEventZeros: per bar, per LC averaged zeros
+	Rezero   bool          // TestEventZeros: true when requested through Rezero
+	Message  string        // TestEventStatus
+	Value    float64       // TestEventStable: the settled grand total; TestEventOverload: the total
+	Progress *ZeroProgress // TestEventZerosProgress
+	Bar      int           // TestEventBarOffline, TestEventBarRecovered, TestEventOverload: 1-based bar number (0 for the grand total)
+}
+
+// LiveTestOptions configures RunLiveTest. Zero values select the defaults.
+type LiveTestOptions struct {
+	Interval    time.Duration   // polling period, 250 ms by default
+	ZeroSamples int             // samples averaged for zeros, parameters.AVG by default
+	Rezero      <-chan struct{} // each receive re-collects the zeros
+}
+
+// Defaults for the stable weight detection when PARAMETERS.TEST leaves them unset.
+const (
+	defaultStableBand = 2.0
+	defaultStableHold = time.Second
+)
+
+// stabilityDetector reports when a value has stayed within band for hold and
+// when it leaves that band again.
+type stabilityDetector struct {
+	band     float64
+	hold     time.Duration
+	since    time.Time
+	min, max float64
+	stable   bool
+}
+
+func newStabilityDetector(parameters *PARAMETERS) *stabilityDetector {
+	d := &stabilityDetector{band: defaultStableBand, hold: defaultStableHold}
+	if t := parameters.TEST; t != nil {
+		if t.STABLEBAND > 0 {
+			d.band = t.STABLEBAND
+		}
+		if t.STABLEMS > 0 {
+			d.hold = time.Duration(t.STABLEMS) * time.Millisecond
+		}
+	}
+	return d
+}
+
+// update feeds a new value and returns the event kind to emit ("" for none).
+func (d *stabilityDetector) update(t time.Time, v float64) string {
+	if d.since.IsZero() || math.Max(d.max, v)-math.Min(d.min, v) > d.band {
+		// moved out of the band: start a new window at this value
+		d.since, d.min, d.max = t, v, v
+		if d.stable {
+			d.stable = false
+			return TestEventUnstable
+		}
+		return ""
+	}
+	d.min, d.max = math.Min(d.min, v), math.Max(d.max, v)
+	if !d.stable && t.Sub(d.since) >= d.hold {
+		d.stable = true
+		return TestEventStable
+	}
+	return ""
+}
+
+// Bar dropout handling in RunLiveTest.
+const (
+	barOfflineAfter     = 3               // consecutive failed reads before a bar is marked offline
+	offlinePingInterval = 2 * time.Second // how often an offline bar is sent a version query
+)
+
+// barHealth tracks one bar's answers during a live test.
+type barHealth struct {
+	failures int
+	offline  bool
+	lastPing time.Time
+	last     *TestSnapshot // snapshot holding the bar's last good reading
+}
+
+// trackBars updates health from snap, emitting barOffline when a bar has
+// failed barOfflineAfter times in a row, and fills the readings of bars that
+// did not answer with their last good values (marked Stale). The grand total
+// then includes those values and is marked GrandStale.
+func trackBars(bars *serialpkg.Leo485, health []*barHealth, snap *TestSnapshot, emit func(TestEvent)) {
+	for i, h := range health {
+		if snap.PerBarOK[i] {
+			h.failures = 0
+			h.last = snap
+			continue
+		}
+		if !h.offline {
+			h.failures++
+			if h.failures >= barOfflineAfter {
+				h.offline = true
+				h.lastPing = snap.Time
+				emit(TestEvent{Kind: TestEventBarOffline, Bar: i + 1, Message: fmt.Sprint(snap.Errors[i])})
+			}
+		}
+		snap.Stale[i] = true
+		if h.last != nil {
+			snap.ADC[i] = h.last.ADC[i]
+			snap.Weight[i] = h.last.Weight[i]
+			snap.PerBarTotal[i] = h.last.PerBarTotal[i]
+			continue
+		}
+		n := bars.NLCsPerBar(i)
+		snap.ADC[i] = make([]int64, n)
+		snap.Weight[i] = make([]float64, n)
+		for lc := range snap.Weight[i] {
+			snap.Weight[i][lc] = math.NaN()
+		}
+		snap.PerBarTotal[i] = math.NaN()
+	}
+	for _, stale := range snap.Stale {
+		if stale {
+			snap.GrandTotal = sumTotals(snap.PerBarTotal)
+			snap.GrandStale = true
+			break
+		}
+	}
+}
+
+// pingOfflineBars sends a version query to each offline bar at most every
+// offlinePingInterval and emits barRecovered for those that answer.
+func pingOfflineBars(bars *serialpkg.Leo485, health []*barHealth, emit func(TestEvent)) {
+	for i, h := range health {
+		if !h.offline || time.Since(h.lastPing) < offlinePingInterval {
+			continue
+		}
+		h.lastPing = time.Now()
+		if _, _, _, err := bars.GetVersion(i); err == nil {
+			h.offline, h.failures = false, 0
+			emit(TestEvent{Kind: TestEventBarRecovered, Bar: i + 1})
+		}
+	}
+}
+
+// overloadState holds the overload flags between passes of a live test.
+type overloadState struct {
+	bars  []bool
+	grand bool
+}
+
+// trackOverload applies the overload hysteresis to snap and emits an
+// "overload" event each time a bar or the grand total goes over capacity.
+func trackOverload(state *overloadState, snap *TestSnapshot, parameters *PARAMETERS, emit func(TestEvent)) {
+	for i, was := range state.bars {
+		state.bars[i] = overloaded(snap.PerBarTotal[i], parameters.BARS[i].CAPACITY, was)
+		snap.PerBarOverload[i] = state.bars[i]
+		if state.bars[i] && !was {
+			emit(TestEvent{Kind: TestEventOverload, Bar: i + 1, Value: snap.PerBarTotal[i]})
+		}
+	}
+	was := state.grand
+	state.grand = overloaded(snap.GrandTotal, parameters.CAPACITY, was)
+	snap.GrandOverload = state.grand
+	if state.grand && !was {
+		emit(TestEvent{Kind: TestEventOverload, Value: snap.GrandTotal})
+	}
+}
+
+// deadPassesBeforeReconnect is the number of consecutive passes in which no
+// polled bar answered after which the adapter is assumed gone and reconnected.
+const deadPassesBeforeReconnect = 3
+
+// offlineReconnectInterval is how often the connection is re-established
+// while every bar is offline: nothing is polled then, and the pings alone
+// cannot recover an adapter that went away.
+const offlineReconnectInterval = 30 * time.Second
+
+// deadPass reports whether snap polled at least one bar and none of the polled
+// bars answered. Bars skipped as offline were not asked and do not count.
+func deadPass(snap *TestSnapshot, skip []bool) bool {
+	polled := false
+	for i, ok := range snap.PerBarOK {
+		if i < len(skip) && skip[i] {
+			continue
+		}
+		if ok {
+			return false
+		}
+		polled = true
+	}
+	return polled
+}
+
+// allOffline reports whether every bar is offline.
+func allOffline(health []*barHealth) bool {
+	for _, h := range health {
+		if !h.offline {
+			return false
+		}
+	}
+	return len(health) > 0
+}
+
+// RunLiveTest owns a live weight test: it collects averaged zeros, then reads
+// a snapshot every Interval and hands it to onSnapshot until ctx is cancelled.
+// Zeros are re-collected whenever opts.Rezero fires, and the connection is
+// re-established in place when no polled bar has answered for a few passes,
+// and every offlineReconnectInterval while all bars are offline. When the
+// grand total stays within PARAMETERS.TEST.STABLEBAND for STABLEMS a "stable"
+// event is emitted (and snapshots carry Stable), followed by "unstable" once
+// it moves again. A bar failing barOfflineAfter reads in a row is reported
+// with a "barOffline" event and no longer read; it is pinged between passes
+// and "barRecovered" is emitted once it answers. Until then snapshots carry
+// its last reading marked Stale. Totals above BAR.CAPACITY or
+// PARAMETERS.CAPACITY are flagged in the snapshots and reported once with an
+// "overload" event until they drop back below capacity. Both callbacks are
+// called from RunLiveTest's goroutine and may be nil.
+// RunLiveTest returns nil once ctx is cancelled.
+func RunLiveTest(ctx context.Context, bars *serialpkg.Leo485, parameters *PARAMETERS, opts LiveTestOptions, onSnapshot func(*TestSnapshot), onEvent func(TestEvent)) error {
+	interval := opts.Interval
+	if interval <= 0 {
+		interval = 250 * time.Millisecond
+	}
+	samples := opts.ZeroSamples
+	if samples <= 0 {
+		samples = parameters.AVG
+	}
+	emit := func(ev TestEvent) {
+		if onEvent != nil {
+			onEvent(ev)
+		}
+	}
+	progress := func(p ZeroProgress) {
+		emit(TestEvent{Kind: TestEventZerosProgress, Progress: &p})
+	}
+	collect := func(rezero bool) [][]int64 {
+		zeros := splitPerBar(collectAveragedZeros(bars, parameters, samples, progress), bars.LCsPerBar())
+		emit(TestEvent{Kind: TestEventZeros, Zeros: zeros, Rezero: rezero})
+		return zeros
+	}
+
+	zerosPerBar := collect(false)
+	stability := newStabilityDetector(parameters)
+	health := make([]*barHealth, len(parameters.BARS))
+	skip := make([]bool, len(health))
+	overload := &overloadState{bars: make([]bool, len(health))}
+	for i := range health {
+		health[i] = &barHealth{}
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	deadPasses := 0
+	var lastReconnect time.Time
+	for {
+		for i, h := range health {
+			skip[i] = h.offline
+		}
+		snap, err := computeSnapshot(ctx, bars, zerosPerBar, parameters, skip)
+		if err != nil {
+			return nil
+		}
+		trackBars(bars, health, snap, emit)
+		trackOverload(overload, snap, parameters, emit)
+		switch stability.update(snap.Time, snap.GrandTotal) {
+		case TestEventStable:
+			emit(TestEvent{Kind: TestEventStable, Value: snap.GrandTotal})
+		case TestEventUnstable:
+			emit(TestEvent{Kind: TestEventUnstable})
+		}
+		snap.Stable = stability.stable
+		if onSnapshot != nil {
+			onSnapshot(snap)
+		}
+
+		if deadPass(snap, skip) {
+			deadPasses++
+		} else {
+			deadPasses = 0
+		}
+		if deadPasses >= deadPassesBeforeReconnect || (allOffline(health) && time.Since(lastReconnect) >= offlineReconnectInterval) {
+			deadPasses = 0
+			lastReconnect = time.Now()
+			if err := bars.Reconnect(ctx, func(msg string) { emit(TestEvent{Kind: TestEventStatus, Message: msg}) }); err != nil {
+				emit(TestEvent{Kind: TestEventStatus, Message: "Reconnect failed: " + err.Error()})
+			} else {
+				// ping the offline bars right away on the new connection
+				for _, h := range health {
+					h.lastPing = time.Time{}
+				}
+			}
+		}
+		pingOfflineBars(bars, health, emit)
+
+		select {
+		case <-ctx.Done():
+			return nil
+		case <-opts.Rezero:
+			zerosPerBar = collect(true)
+			stability = newStabilityDetector(parameters)
+		case <-ticker.C:
+		}
+	}
+}
+
+// splitPerBar reshapes a flat per-LC slice into one slice per bar, bar i
+// taking the next lcsPerBar[i] values.
+func splitPerBar(flat []int64, lcsPerBar []int) [][]int64 {
+	perBar := make([][]int64, len(lcsPerBar))
+	idx := 0
+	for i, nlcs := range lcsPerBar {
+		perBar[i] = make([]int64, nlcs)
+		for j := 0; j < nlcs; j++ {
+			if idx < len(flat) {
+				perBar[i][j] = flat[idx]
+			}
+			idx++
+		}
+	}
+	return perBar
+}
@@ -0,0 +1,101 @@
+package calibration
+
+import (
+	"testing"
+	"time"
+)
+
+// snapshotOf returns a snapshot with the given per-bar totals, one load cell
+// per bar; bars with ok false did not answer.
+func snapshotOf(totals []float64, ok []bool) *TestSnapshot {
+	s := &TestSnapshot{
+		Time:        time.Now(),
+		ADC:         make([][]int64, len(totals)),
+		Weight:      make([][]float64, len(totals)),
+		PerBarTotal: make([]float64, len(totals)),
+		PerBarOK:    ok,
+		Errors:      make([]error, len(totals)),
+		Stale:       make([]bool, len(totals)),
+	}
+	for i, v := range totals {
+		if !ok[i] {
+			continue
+		}
+		s.ADC[i] = []int64{int64(v)}
+		s.Weight[i] = []float64{v}
+		s.PerBarTotal[i] = v
+		s.GrandTotal += v
+	}
+	return s
+}
+
+func TestDeadPass(t *testing.T) {
+	for _, tc := range []struct {
+		name string
+		ok   []bool
+		skip []bool
+		want bool
+	}{
+		{"one bar answered", []bool{false, true}, []bool{false, false}, false},
+		{"no bar answered", []bool{false, false}, []bool{false, false}, true},
+		{"offline bar not counted", []bool{false, false}, []bool{true, false}, true},
+		{"every bar offline", []bool{false, false}, []bool{true, true}, false},
+	} {
+		if got := deadPass(snapshotOf([]float64{1, 2}, tc.ok), tc.skip); got != tc.want {
+			t.Errorf("%s: deadPass = %v, want %v", tc.name, got, tc.want)
+		}
+	}
+}
+
+func TestTrackBarsStaleGrandTotal(t *testing.T) {
+	health := []*barHealth{{}, {}}
+	noEvents := func(ev TestEvent) { t.Errorf("unexpected event %+v", ev) }
+
+	trackBars(nil, health, snapshotOf([]float64{10, 40}, []bool{true, true}), noEvents)
+	snap := snapshotOf([]float64{12, 0}, []bool{true, false})
+	trackBars(nil, health, snap, noEvents)
+
+	if !snap.Stale[1] || snap.Stale[0] {
+		t.Errorf("Stale = %v, want only bar 2", snap.Stale)
+	}
+	if snap.PerBarTotal[1] != 40 {
+		t.Errorf("bar 2 total = %g, want its last reading 40", snap.PerBarTotal[1])
+	}
+	if snap.GrandTotal != 52 || !snap.GrandStale {
+		t.Errorf("grand total = %g (stale %v), want 52 including the last reading", snap.GrandTotal, snap.GrandStale)
+	}
+
+	fresh := snapshotOf([]float64{12, 41}, []bool{true, true})
+	trackBars(nil, health, fresh, noEvents)
+	if fresh.GrandStale || fresh.GrandTotal != 53 {
+		t.Errorf("grand total = %g (stale %v) once every bar answers, want 53", fresh.GrandTotal, fresh.GrandStale)
+	}
+}
+
+func TestAllOffline(t *testing.T) {
+	if allOffline([]*barHealth{{offline: true}, {}}) {
+		t.Error("one bar online reported as all offline")
+	}
+	if !allOffline([]*barHealth{{offline: true}, {offline: true}}) {
+		t.Error("every bar offline not reported")
+	}
+}
+
+func TestTareBar(t *testing.T) {
+	for _, tc := range []struct {
+		k    rune
+		bar  int
+		want bool
+	}{
+		{'1', 0, true},
+		{'3', 2, true},
+		{'4', 0, false}, // only three bars
+		{'0', 0, false},
+		{27, 0, false}, // ESC is handled as usual, not swallowed
+		{'R', 0, false},
+	} {
+		if bar, ok := tareBar(tc.k, 3); ok != tc.want || bar != tc.bar {
+			t.Errorf("tareBar(%q) = %d, %v; want %d, %v", tc.k, bar, ok, tc.bar, tc.want)
+		}
+	}
+}
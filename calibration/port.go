@@ -0,0 +1,125 @@
+package calibration
+
+import (
+	"fmt"
+	"time"
+
+	file "github.com/CK6170/Calrunrilla-go/file"
+	serialpkg "github.com/CK6170/Calrunrilla-go/serial"
+	"github.com/CK6170/Calrunrilla-go/ui"
+)
+
+// PortSource tells how EnsureSerialPort settled on a serial port.
+type PortSource string
+
+const (
+	PortConfigured PortSource = "configured" // the PORT from the config answered
+	PortDetected   PortSource = "detected"   // PORT was empty or silent; auto-detect found one
+	PortFailed     PortSource = "failed"     // no answering port found
+)
+
+// EnsureSerialPort makes sure parameters.SERIAL.PORT names a port that opens
+// and answers the version command on the first bar. When PORT is empty, cannot
+// be opened or does not answer, the COM ports are scanned instead. A detected
+// port is written back to configPath only when persist is true. On failure
+// PORT is left as configured and PortFailed is returned with an error.
+func EnsureSerialPort(configPath string, parameters *PARAMETERS, persist bool) (PortSource, error) {
+	ser := parameters.SERIAL
+	if ser.PORT == "" {
+		ui.Debugf(parameters.DEBUG, "Serial PORT missing in JSON, attempting auto-detect...\n")
+	} else {
+		ui.Debugf(parameters.DEBUG, "Trying configured port: %s (baud %d)\n", ser.PORT, ser.BAUDRATE)
+		if serialpkg.TestPort(ser.PORT, parameters.BARS[0].ID, ser.BAUDRATE) {
+			return PortConfigured, nil
+		}
+		ui.Debugf(parameters.DEBUG, "Port %s did not answer the version probe, attempting auto-detect...\n", ser.PORT)
+	}
+	ui.Debugf(parameters.DEBUG, "Starting serial auto-detect across COM ports (this may take a few seconds)...\n")
+	p := serialpkg.AutoDetectPort(parameters)
+	if p == "" {
+		return PortFailed, fmt.Errorf("could not auto-detect serial port")
+	}
+	ser.PORT = p
+	if persist {
+		file.PersistParameters(configPath, parameters)
+		ui.Debugf(parameters.DEBUG, "Detected serial port: %s (saved to JSON)\n", p)
+	} else {
+		ui.Debugf(parameters.DEBUG, "Detected serial port: %s\n", p)
+	}
+	return PortDetected, nil
+}
+
+// ConnectWithRecovery opens the bars on a working serial port and checks that
+// they answer the version command. When they do not, every bar is sent a
+// reboot and probed again; if they still do not answer, the COM ports are
+// scanned once more and the bars reopened on the port found. Progress is
+// reported through onStatus (which may be nil). persist controls whether a
+// newly detected port is saved back to configPath.
+func ConnectWithRecovery(configPath string, parameters *PARAMETERS, persist bool, onStatus func(string)) (*serialpkg.Leo485, error) {
+	status := func(format string, a ...interface{}) {
+		if onStatus != nil {
+			onStatus(fmt.Sprintf(format, a...))
+		}
+	}
+	src, err := EnsureSerialPort(configPath, parameters, persist)
+	if err != nil {
+		if parameters.SERIAL.PORT == "" {
+			return nil, err
+		}
+		// Bars on the configured port may only need a reboot; the recovery below handles that.
+		status("No answering port found, continuing with configured port %s", parameters.SERIAL.PORT)
+	}
+	ui.Debugf(parameters.DEBUG, "Serial port %s (%s)\n", parameters.SERIAL.PORT, src)
+
+	ui.Debugf(parameters.DEBUG, "Opening Leo485 with port %s...\n", parameters.SERIAL.PORT)
+	bars, err := serialpkg.OpenLeo485(parameters.SERIAL, parameters.BARS)
+	if err != nil {
+		return nil, err
+	}
+
+	// Quick version probe; if fails, try reboot and then auto-detect fallback (in case wrong but openable port)
+	ui.Debugf(parameters.DEBUG, "Probing device version...\n")
+	if ProbeVersion(bars, parameters) {
+		return bars, nil
+	}
+	status("No version response from %s. Attempting reboot of all bars...", parameters.SERIAL.PORT)
+	// Try to reboot each bar once and allow time to recover
+	for i := range bars.Bars {
+		if bars.Reboot(i) {
+			status("Bar %d reboot command sent", i+1)
+		} else {
+			status("Bar %d reboot command failed or no response", i+1)
+		}
+		time.Sleep(200 * time.Millisecond)
+	}
+	// Wait a short while for devices to restart
+	status("Waiting for bars to reboot...")
+	time.Sleep(1500 * time.Millisecond)
+	if ProbeVersion(bars, parameters) {
+		status("Version response received after reboot")
+		return bars, nil
+	}
+
+	status("No version response from %s after reboot, re-attempting auto-detect...", parameters.SERIAL.PORT)
+	_ = bars.Close()
+	p := serialpkg.AutoDetectPort(parameters)
+	if p == "" {
+		return nil, fmt.Errorf("no version response from %s and no other port answered", parameters.SERIAL.PORT)
+	}
+	if p != parameters.SERIAL.PORT {
+		parameters.SERIAL.PORT = p
+		if persist {
+			file.PersistParameters(configPath, parameters)
+		}
+		status("Updated serial port after probe: %s", p)
+	}
+	bars, err = serialpkg.OpenLeo485(parameters.SERIAL, parameters.BARS)
+	if err != nil {
+		return nil, err
+	}
+	if !ProbeVersion(bars, parameters) {
+		_ = bars.Close()
+		return nil, fmt.Errorf("no version response from %s", parameters.SERIAL.PORT)
+	}
+	return bars, nil
+}
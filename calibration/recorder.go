@@ -0,0 +1,186 @@
+package calibration
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// defaultRecordingMaxBytes is the size at which a recording started from the
+// live test is rotated to a new file.
+const defaultRecordingMaxBytes = 10 << 20
+
+// SnapshotRecorder appends TestSnapshots to a CSV file, or to a JSON-lines
+// file when the path ends in ".jsonl". CSV headers are generated from the
+// bar/LC layout. When the file would grow past maxBytes it is renamed with a
+// timestamp suffix and a fresh file (with a new header) is started.
+type SnapshotRecorder struct {
+	path      string
+	jsonl     bool
+	lcsPerBar []int
+	maxBytes  int64
+	f         *os.File
+	size      int64
+}
+
+// NewSnapshotRecorder opens (or creates) path for recording. lcsPerBar gives
+// the number of load cells of each bar; maxBytes <= 0 disables rotation.
+func NewSnapshotRecorder(path string, lcsPerBar []int, maxBytes int64) (*SnapshotRecorder, error) {
+	r := &SnapshotRecorder{
+		path:      path,
+		jsonl:     strings.EqualFold(filepath.Ext(path), ".jsonl"),
+		lcsPerBar: lcsPerBar,
+		maxBytes:  maxBytes,
+	}
+	if err := r.open(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Path returns the file currently being written.
+func (r *SnapshotRecorder) Path() string { return r.path }
+
+func (r *SnapshotRecorder) open() error {
+	f, err := os.OpenFile(r.path, os.O_APPEND|os.O_CREATE|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		_ = f.Close()
+		return err
+	}
+	r.f = f
+	r.size = info.Size()
+	if r.size == 0 && !r.jsonl {
+		return r.write(r.csvHeader())
+	}
+	return nil
+}
+
+func (r *SnapshotRecorder) write(line string) error {
+	n, err := r.f.WriteString(line)
+	r.size += int64(n)
+	return err
+}
+
+// rotate moves the current file aside as <name>_<timestamp><ext> and reopens path.
+func (r *SnapshotRecorder) rotate() error {
+	if err := r.f.Close(); err != nil {
+		return err
+	}
+	ext := filepath.Ext(r.path)
+	rotated := fmt.Sprintf("%s_%s%s", strings.TrimSuffix(r.path, ext), time.Now().Format("20060102-150405.000"), ext)
+	if err := os.Rename(r.path, rotated); err != nil {
+		return err
+	}
+	return r.open()
+}
+
+// Record appends one snapshot.
+func (r *SnapshotRecorder) Record(s *TestSnapshot) error {
+	var line string
+	if r.jsonl {
+		line = r.jsonLine(s)
+	} else {
+		line = r.csvLine(s)
+	}
+	if r.maxBytes > 0 && r.size > 0 && r.size+int64(len(line)) > r.maxBytes {
+		if err := r.rotate(); err != nil {
+			return err
+		}
+	}
+	return r.write(line)
+}
+
+// Close flushes and closes the recording file.
+func (r *SnapshotRecorder) Close() error {
+	if err := r.f.Sync(); err != nil {
+		_ = r.f.Close()
+		return err
+	}
+	return r.f.Close()
+}
+
+func (r *SnapshotRecorder) csvHeader() string {
+	cols := []string{"timestamp", "grand_total"}
+	for i := range r.lcsPerBar {
+		cols = append(cols, fmt.Sprintf("bar%d_total", i+1))
+	}
+	for i, n := range r.lcsPerBar {
+		for lc := 0; lc < n; lc++ {
+			cols = append(cols, fmt.Sprintf("bar%d_lc%d_weight", i+1, lc+1), fmt.Sprintf("bar%d_lc%d_adc", i+1, lc+1))
+		}
+	}
+	return strings.Join(cols, ",") + "\n"
+}
+
+func (r *SnapshotRecorder) csvLine(s *TestSnapshot) string {
+	cols := []string{s.Time.Format("2006-01-02 15:04:05.000"), fmt.Sprintf("%.1f", s.GrandTotal)}
+	for i := range r.lcsPerBar {
+		if i < len(s.PerBarOK) && s.PerBarOK[i] {
+			cols = append(cols, fmt.Sprintf("%.1f", s.PerBarTotal[i]))
+		} else {
+			cols = append(cols, "")
+		}
+	}
+	for i, n := range r.lcsPerBar {
+		for lc := 0; lc < n; lc++ {
+			if i < len(s.PerBarOK) && s.PerBarOK[i] && lc < len(s.Weight[i]) {
+				cols = append(cols, fmt.Sprintf("%.1f", s.Weight[i][lc]), fmt.Sprintf("%d", s.ADC[i][lc]))
+			} else {
+				cols = append(cols, "", "")
+			}
+		}
+	}
+	return strings.Join(cols, ",") + "\n"
+}
+
+func (r *SnapshotRecorder) jsonLine(s *TestSnapshot) string {
+	row := struct {
+		TIME       string      `json:"TIME"`
+		GRANDTOTAL float64     `json:"GRANDTOTAL"`
+		BARTOTALS  []float64   `json:"BARTOTALS"`
+		WEIGHT     [][]float64 `json:"WEIGHT"`
+		ADC        [][]int64   `json:"ADC"`
+		OK         []bool      `json:"OK"`
+	}{
+		TIME:       s.Time.Format(time.RFC3339Nano),
+		GRANDTOTAL: s.GrandTotal,
+		BARTOTALS:  s.PerBarTotal,
+		WEIGHT:     s.Weight,
+		ADC:        s.ADC,
+		OK:         s.PerBarOK,
+	}
+	data, _ := json.Marshal(row)
+	return string(data) + "\n"
+}
+
+// snapshotLogPath names the CSV that single snapshots taken with 's' in the
+// live test are appended to, e.g. config.json -> config_test_log.csv.
+func snapshotLogPath(configPath string) string {
+	return strings.TrimSuffix(configPath, ".json") + "_test_log.csv"
+}
+
+// appendSnapshot appends s to the CSV at path, writing the header first when
+// the file is new.
+func appendSnapshot(path string, lcsPerBar []int, s *TestSnapshot) error {
+	r, err := NewSnapshotRecorder(path, lcsPerBar, 0)
+	if err != nil {
+		return err
+	}
+	if err := r.Record(s); err != nil {
+		_ = r.Close()
+		return err
+	}
+	return r.Close()
+}
+
+// recordingPath names a new live test recording next to the config file.
+func recordingPath(configPath string) string {
+	return fmt.Sprintf("%s_test_%s.csv", strings.TrimSuffix(configPath, ".json"), time.Now().Format("20060102-150405"))
+}
@@ -0,0 +1,175 @@
+package calibration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"time"
+
+	file "github.com/CK6170/Calrunrilla-go/file"
+	"github.com/CK6170/Calrunrilla-go/matrix"
+	serialpkg "github.com/CK6170/Calrunrilla-go/serial"
+	"github.com/CK6170/Calrunrilla-go/ui"
+)
+
+var (
+	repeatloadmsg   = "\nPut %s on the marked spot and Press 'C' to continue. Or <ESC> to exit."
+	repeatunloadmsg = "\nRemove the weight and Press 'C' to continue. Or <ESC> to exit."
+)
+
+// defaultRepeatCycles is used when PARAMETERS.TEST.CYCLES is unset.
+const defaultRepeatCycles = 5
+
+// RepeatabilityReport is the outcome of RunRepeatabilityTest.
+type RepeatabilityReport struct {
+	CREATED  string    `json:"CREATED"`
+	WEIGHT   float64   `json:"WEIGHT"`
+	READINGS []float64 `json:"READINGS"` // one loaded grand total per cycle
+	MEAN     float64   `json:"MEAN"`
+	STDDEV   float64   `json:"STDDEV"`
+	MAXDEV   float64   `json:"MAXDEV"` // largest |reading - MEAN|
+	LIMIT    float64   `json:"LIMIT"`
+	PASS     bool      `json:"PASS"`
+}
+
+// RepeatPrompt is handed to the RunRepeatabilityTest callback before each
+// sampling. Cycle is 0 for the initial step, where the bays must be cleared
+// so the zeros can be collected.
+type RepeatPrompt struct {
+	Cycle  int
+	Cycles int
+	Load   bool // true when the weight must be placed, false when removed
+	Prompt string
+}
+
+// repeatSettings returns the configured cycle count and pass limit on MAXDEV.
+func repeatSettings(parameters *PARAMETERS, weight float64) (int, float64) {
+	cycles, limit := defaultRepeatCycles, weight/200
+	if t := parameters.TEST; t != nil {
+		if t.CYCLES > 0 {
+			cycles = t.CYCLES
+		}
+		if t.REPEATMAX > 0 {
+			limit = t.REPEATMAX
+		}
+	}
+	return cycles, limit
+}
+
+// RunRepeatabilityTest has the operator load and unload weight at the same
+// spot cycles times and reports the spread of the loaded readings. It passes
+// when the largest deviation from the mean is within limit. onPrompt is called
+// before the zeros are collected and before every load and unload; it must
+// return once the operator is ready, or an error to abort the test.
+func RunRepeatabilityTest(ctx context.Context, bars *serialpkg.Leo485, parameters *PARAMETERS, weight float64, cycles int, limit float64, onPrompt func(RepeatPrompt) error) (*RepeatabilityReport, error) {
+	if cycles < 2 {
+		return nil, errors.New("the repeatability test needs at least two cycles")
+	}
+	report := &RepeatabilityReport{
+		CREATED: time.Now().Format(time.RFC3339),
+		WEIGHT:  weight,
+		LIMIT:   limit,
+	}
+	if err := onPrompt(RepeatPrompt{Cycles: cycles, Prompt: zeromsg}); err != nil {
+		return report, err
+	}
+	zerosPerBar := splitPerBar(collectAveragedZeros(bars, parameters, parameters.AVG, nil), bars.LCsPerBar())
+
+	for c := 1; c <= cycles; c++ {
+		if err := onPrompt(RepeatPrompt{Cycle: c, Cycles: cycles, Load: true, Prompt: fmt.Sprintf(repeatloadmsg, formatWeight(weight))}); err != nil {
+			return report, err
+		}
+		reading, err := sampleGrandTotal(ctx, bars, zerosPerBar, parameters)
+		if err != nil {
+			return report, err
+		}
+		report.READINGS = append(report.READINGS, reading)
+		if c < cycles {
+			if err := onPrompt(RepeatPrompt{Cycle: c, Cycles: cycles, Prompt: repeatunloadmsg}); err != nil {
+				return report, err
+			}
+		}
+	}
+
+	report.MEAN = matrix.Mean(report.READINGS)
+	report.STDDEV = matrix.StdDev(report.READINGS)
+	lo, hi := matrix.MinMax(report.READINGS)
+	report.MAXDEV = math.Max(report.MEAN-lo, hi-report.MEAN)
+	report.PASS = report.MAXDEV <= limit
+	return report, nil
+}
+
+// csv formats the report as lines for the _debug.csv file.
+func (r *RepeatabilityReport) csv() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "%s,Repeatability,%g\n", time.Now().Format("2006-01-02 15:04:05"), r.WEIGHT)
+	sb.WriteString("Readings")
+	for _, v := range r.READINGS {
+		fmt.Fprintf(&sb, ",%.3f", v)
+	}
+	sb.WriteString("\n")
+	fmt.Fprintf(&sb, "Mean,%.3f\nStdDev,%.3f\nMaxDeviation,%.3f\nLimit,%g\n", r.MEAN, r.STDDEV, r.MAXDEV, r.LIMIT)
+	result := "FAIL"
+	if r.PASS {
+		result = "PASS"
+	}
+	sb.WriteString("Result," + result)
+	return sb.String()
+}
+
+// RepeatabilityTestConfig loads parameters from a config, runs the
+// interactive repeatability test with WEIGHT and appends the report to the
+// config's _debug.csv file.
+func RepeatabilityTestConfig(configPath string) {
+	loaded, err := file.LoadParameters(configPath)
+	if err != nil {
+		log.Fatalf("Invalid config %s:\n%v", configPath, err)
+	}
+	parameters := *loaded
+	if parameters.IGNORE <= 0 {
+		parameters.IGNORE = parameters.AVG
+	}
+	bars, err := ConnectWithRecovery(configPath, &parameters, false, printStatus)
+	if err != nil {
+		log.Fatalf("Cannot connect to the bars: %v", err)
+	}
+	defer func() { _ = bars.Close() }()
+	warnVersions(bars, &parameters)
+	factorSrc, err := EnsureFactorsFromDevice(bars, &parameters)
+	if err != nil {
+		log.Fatalf("Cannot read the factors from the bars: %v", err)
+	}
+	ui.Debugf(parameters.DEBUG, "Using factors from %s\n", factorSrc)
+
+	weight := parameters.WEIGHT
+	if weight <= 0 {
+		log.Fatal("The repeatability test needs WEIGHT in the config")
+	}
+	cycles, limit := repeatSettings(&parameters, weight)
+	report, err := RunRepeatabilityTest(context.Background(), bars, &parameters, weight, cycles, limit, func(p RepeatPrompt) error {
+		if p.Load {
+			ui.Greenf("\nCycle %d/%d", p.Cycle, p.Cycles)
+		}
+		return waitForContinue(p.Prompt)
+	})
+	if err != nil {
+		log.Fatalf("Repeatability test stopped: %v", err)
+	}
+
+	fmt.Println()
+	for i, v := range report.READINGS {
+		fmt.Printf("[%02d] %10.1f  %+8.1f\n", i+1, v, v-report.MEAN)
+	}
+	fmt.Printf("Mean %.1f, std dev %.2f, max deviation %.2f (limit %s)\n", report.MEAN, report.STDDEV, report.MAXDEV, formatWeight(report.LIMIT))
+	if report.PASS {
+		ui.Greenf("Repeatability test passed\n")
+	} else {
+		ui.Warningf("Repeatability test failed\n")
+	}
+	debugPath := strings.Replace(configPath, ".json", "_debug.csv", 1)
+	file.AppendToFile(debugPath, report.csv())
+	ui.Debugf(parameters.DEBUG, "Report appended to %s\n", debugPath)
+}
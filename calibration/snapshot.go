@@ -0,0 +1,305 @@
+package calibration
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"math"
+	"strings"
+	"time"
+
+	serialpkg "github.com/CK6170/Calrunrilla-go/serial"
+)
+
+// TestSnapshot is one pass of live readings over every bar: raw counts, the
+// weights derived from the zeros and factors, and the totals.
+type TestSnapshot struct {
+	Time        time.Time
+	ADC         [][]int64   // per bar, per LC raw counts
+	Weight      [][]float64 // per bar, per LC (ADC - zero) * factor
+	PerBarTotal []float64
+	GrandTotal  float64
+	PerBarOK    []bool  // false for bars that did not answer this pass
+	Errors      []error // per bar read error, nil when the bar answered
+	Stable      bool    // set by RunLiveTest while the grand total is settled
+	// Stale is set by RunLiveTest for bars that did not answer: their ADC and
+	// Weight repeat the last good reading (NaN weights when there was none).
+	// GrandTotal then includes their last-known totals and GrandStale is set.
+	Stale      []bool
+	GrandStale bool
+	// PerBarName and PerBarLCLabel are the display names of the bars and
+	// their load cells (BAR.NAME / LC.LABEL, or "Bar n" / "LC n").
+	PerBarName    []string
+	PerBarLCLabel [][]string
+	// PerBarOverload and GrandOverload flag totals above BAR.CAPACITY and
+	// PARAMETERS.CAPACITY. RunLiveTest keeps a flag set until the total drops
+	// overloadHysteresis below the capacity.
+	PerBarOverload []bool
+	GrandOverload  bool
+	// Tared marks the bars whose Weight and PerBarTotal are net of a live
+	// test tare; PerBarGross and GrossTotal then hold the untared totals.
+	// All three are nil/0 while nothing is tared.
+	Tared       []bool
+	PerBarGross []float64
+	GrossTotal  float64
+}
+
+// overloadHysteresis is the share of the capacity a total must fall below it
+// before RunLiveTest clears an overload.
+const overloadHysteresis = 0.02
+
+// overloaded reports whether total exceeds capacity (0 meaning no limit),
+// given whether it was overloaded before.
+func overloaded(total, capacity float64, was bool) bool {
+	if capacity <= 0 {
+		return false
+	}
+	if math.IsNaN(total) {
+		return was
+	}
+	if was {
+		return total > capacity*(1-overloadHysteresis)
+	}
+	return total > capacity
+}
+
+// errBarOffline is reported in TestSnapshot.Errors for bars RunLiveTest has
+// stopped reading until they answer a version ping again.
+var errBarOffline = errors.New("bar offline")
+
+// perBarTimeout bounds the ADC read of a single bar in ComputeTestSnapshot so
+// one unresponsive bar cannot stall the whole pass.
+const perBarTimeout = 200 * time.Millisecond
+
+// ComputeTestSnapshot reads every bar once and converts the counts to weights.
+// zerosPerBar (collected at the start of the test) take precedence over the
+// ZERO values stored in parameters. Each bar read is bounded by perBarTimeout
+// (or less when ctx has an earlier deadline). A bar that fails to answer keeps
+// empty readings, PerBarOK false and its error in Errors; the other bars are
+// still read. When ctx is cancelled the remaining bars are skipped and the
+// partial snapshot is returned with ctx's error.
+func ComputeTestSnapshot(ctx context.Context, bars *serialpkg.Leo485, zerosPerBar [][]int64, parameters *PARAMETERS) (*TestSnapshot, error) {
+	return computeSnapshot(ctx, bars, zerosPerBar, parameters, nil)
+}
+
+// computeSnapshot is ComputeTestSnapshot skipping the bars marked in skip
+// (which may be nil); they are reported with errBarOffline.
+func computeSnapshot(ctx context.Context, bars *serialpkg.Leo485, zerosPerBar [][]int64, parameters *PARAMETERS, skip []bool) (*TestSnapshot, error) {
+	nbars := len(parameters.BARS)
+	s := &TestSnapshot{
+		Time:        time.Now(),
+		ADC:         make([][]int64, nbars),
+		Weight:      make([][]float64, nbars),
+		PerBarTotal: make([]float64, nbars),
+		PerBarOK:    make([]bool, nbars),
+		Errors:      make([]error, nbars),
+		Stale:       make([]bool, nbars),
+
+		PerBarOverload: make([]bool, nbars),
+	}
+	s.PerBarName, s.PerBarLCLabel = barLabels(bars, parameters)
+	for i := 0; i < nbars; i++ {
+		if err := ctx.Err(); err != nil {
+			for j := i; j < nbars; j++ {
+				s.Errors[j] = err
+			}
+			return s, err
+		}
+		if i < len(skip) && skip[i] {
+			s.Errors[i] = errBarOffline
+			continue
+		}
+		timeout := perBarTimeout
+		if deadline, ok := ctx.Deadline(); ok && time.Until(deadline) < timeout*3/2 {
+			timeout = time.Until(deadline) * 2 / 3
+		}
+		ad, err := bars.GetADsTimeout(i, int(timeout/time.Millisecond))
+		if err != nil {
+			s.Errors[i] = err
+			continue
+		}
+		s.PerBarOK[i] = true
+		nlcs := bars.NLCsPerBar(i)
+		s.ADC[i] = make([]int64, nlcs)
+		s.Weight[i] = make([]float64, nlcs)
+		for lc := 0; lc < nlcs; lc++ {
+			adc := int64(0)
+			if lc < len(ad) {
+				adc = int64(ad[lc])
+			}
+			zero := float64(0)
+			factor := float64(1)
+			// Prefer collected zeros from the interactive test (zerosPerBar) when available.
+			if i < len(zerosPerBar) && lc < len(zerosPerBar[i]) {
+				zero = float64(zerosPerBar[i][lc])
+				if lc < len(parameters.BARS[i].LC) {
+					factor = float64(parameters.BARS[i].LC[lc].FACTOR)
+				}
+			} else if lc < len(parameters.BARS[i].LC) {
+				zero = parameters.BARS[i].LC[lc].ZERO
+				factor = float64(parameters.BARS[i].LC[lc].FACTOR)
+			}
+			w := (float64(adc) - zero) * factor
+			s.ADC[i][lc] = adc
+			s.Weight[i][lc] = w
+			s.PerBarTotal[i] += w
+		}
+		s.GrandTotal += s.PerBarTotal[i]
+		s.PerBarOverload[i] = overloaded(s.PerBarTotal[i], parameters.BARS[i].CAPACITY, false)
+	}
+	s.GrandOverload = overloaded(s.GrandTotal, parameters.CAPACITY, false)
+	return s, nil
+}
+
+// sumTotals adds up the bar totals that are known (not NaN).
+func sumTotals(perBar []float64) float64 {
+	sum := 0.0
+	for _, v := range perBar {
+		if !math.IsNaN(v) {
+			sum += v
+		}
+	}
+	return sum
+}
+
+// barLabels returns the display name of every bar and of its load cells.
+func barLabels(bars *serialpkg.Leo485, parameters *PARAMETERS) ([]string, [][]string) {
+	names := make([]string, len(parameters.BARS))
+	labels := make([][]string, len(parameters.BARS))
+	for i, bar := range parameters.BARS {
+		names[i] = bar.Name(i)
+		labels[i] = make([]string, bars.NLCsPerBar(i))
+		for j := range labels[i] {
+			labels[i][j] = bar.LCLabel(j)
+		}
+	}
+	return names, labels
+}
+
+// graphWidth is the number of cells of the bar graphs in the live table.
+const graphWidth = 20
+
+// weightGraph draws v as a horizontal bar that is full at scale. Against a
+// capacity the bar turns yellow from 70% and red from 90%; otherwise it stays
+// green. Negative values draw a short leftward bar in red.
+func weightGraph(v, scale float64, capacity bool) string {
+	if math.IsNaN(v) || scale <= 0 {
+		return "|" + strings.Repeat(" ", graphWidth) + "|"
+	}
+	if v < 0 {
+		n := min(int(math.Ceil(-v/scale*graphWidth)), 3)
+		return "\033[31m" + strings.Repeat("<", n) + "\033[0m|" + strings.Repeat(" ", graphWidth) + "|"
+	}
+	frac := v / scale
+	n := min(int(math.Round(frac*graphWidth)), graphWidth)
+	color := "\033[32m"
+	if capacity && frac >= 0.9 {
+		color = "\033[31m"
+	} else if capacity && frac >= 0.7 {
+		color = "\033[33m"
+	}
+	return "|" + color + strings.Repeat("=", n) + "\033[0m" + strings.Repeat(" ", graphWidth-n) + "|"
+}
+
+// graphScales returns the full-scale value of the load cell and bar graphs of
+// bar i: its CAPACITY (shared evenly by the load cells) when set, otherwise
+// the largest reading of the snapshot and at least WEIGHT.
+func graphScales(s *TestSnapshot, parameters *PARAMETERS, i int) (lcScale, barScale float64, capacity bool) {
+	if c := parameters.BARS[i].CAPACITY; c > 0 && len(s.Weight[i]) > 0 {
+		return c / float64(len(s.Weight[i])), c, true
+	}
+	lcScale, barScale = parameters.WEIGHT, parameters.WEIGHT
+	for j := range s.PerBarTotal {
+		if !s.PerBarOK[j] {
+			continue
+		}
+		barScale = math.Max(barScale, math.Abs(s.PerBarTotal[j]))
+		for _, w := range s.Weight[j] {
+			lcScale = math.Max(lcScale, math.Abs(w))
+		}
+	}
+	return lcScale, barScale, false
+}
+
+// printSnapshot prints the weight table for one snapshot below header and a
+// status line (which may be empty), with a bar graph next to every load cell
+// and bar total (see graphScales).
+func printSnapshot(s *TestSnapshot, header, status string, parameters *PARAMETERS) {
+	lineWidth := 80
+	fmt.Printf("\033[92m%-80s\033[0m\n%s\033[K\n", header, status)
+	for i := range s.PerBarTotal {
+		if !s.PerBarOK[i] && s.Weight[i] != nil {
+			printStaleBar(s, i, lineWidth)
+			continue
+		}
+		fmt.Printf("%-80s\n", s.PerBarName[i]+":")
+		if !s.PerBarOK[i] {
+			log.Printf("%s read error: %v", s.PerBarName[i], s.Errors[i])
+			continue
+		}
+		lcScale, barScale, capacity := graphScales(s, parameters, i)
+		for lc, w := range s.Weight[i] {
+			var line string
+			if w >= 0 {
+				line = fmt.Sprintf("  %-11s \033[32mW=%7.1f\033[0m  ADC=%12d", s.PerBarLCLabel[i][lc]+":", w, s.ADC[i][lc])
+			} else {
+				line = fmt.Sprintf("  %-11s \033[31mW=%7.1f\033[0m  ADC=%12d", s.PerBarLCLabel[i][lc]+":", w, s.ADC[i][lc])
+			}
+			// colour codes make the padding fall short; clear the rest of the line
+			fmt.Printf("%-*s\033[K\n", lineWidth, line+"  "+weightGraph(w, lcScale, capacity))
+		}
+		bt := fmt.Sprintf("  \033[33mBar total:%10.1f\033[0m", s.PerBarTotal[i])
+		if s.PerBarOverload[i] {
+			bt = fmt.Sprintf("  \033[31mBar total:%10.1f\033[0m", s.PerBarTotal[i])
+		}
+		// line the graph up with the load cell graphs above
+		pad := strings.Repeat(" ", 21)
+		if i < len(s.Tared) && s.Tared[i] {
+			pad = fmt.Sprintf("  (gross%10.1f)  ", s.PerBarGross[i])
+		}
+		bt += pad + weightGraph(s.PerBarTotal[i], barScale, capacity)
+		if s.PerBarOverload[i] {
+			bt += "  \033[31m[OVERLOAD]\033[0m"
+		}
+		fmt.Printf("%-*s\033[K\n\n", lineWidth, bt)
+	}
+	gt := fmt.Sprintf("\033[36mGrand total:%10.1f\033[0m", s.GrandTotal)
+	if s.GrandOverload {
+		gt = fmt.Sprintf("\033[31mGrand total:%10.1f  [OVERLOAD]\033[0m", s.GrandTotal)
+	}
+	if s.Tared != nil {
+		gt += fmt.Sprintf("  (gross%10.1f)", s.GrossTotal)
+	}
+	if s.GrandStale {
+		gt += "  \033[90m[STALE]\033[0m"
+	}
+	if s.Stable {
+		gt += "  \033[92m[STABLE]\033[0m"
+	}
+	fmt.Printf("%-*s\033[K\n", lineWidth, gt)
+}
+
+// printStaleBar prints the block of a bar that did not answer in grey, with
+// its last reading, using as many lines as a live bar block.
+func printStaleBar(s *TestSnapshot, i int, lineWidth int) {
+	fmt.Print("\033[90m")
+	state := "no answer"
+	if errors.Is(s.Errors[i], errBarOffline) {
+		state = "OFFLINE"
+	}
+	fmt.Printf("%-*s\n", lineWidth, fmt.Sprintf("%s: %s (last reading)", s.PerBarName[i], state))
+	for lc, w := range s.Weight[i] {
+		if math.IsNaN(w) {
+			fmt.Printf("%-*s\n", lineWidth, fmt.Sprintf("  %-11s W=    ---  ADC=         ---", s.PerBarLCLabel[i][lc]+":"))
+		} else {
+			fmt.Printf("%-*s\n", lineWidth, fmt.Sprintf("  %-11s W=%7.1f  ADC=%12d", s.PerBarLCLabel[i][lc]+":", w, s.ADC[i][lc]))
+		}
+	}
+	if math.IsNaN(s.PerBarTotal[i]) {
+		fmt.Printf("%-*s\n\n", lineWidth, "  Bar total:       ---")
+	} else {
+		fmt.Printf("%-*s\n\n", lineWidth, fmt.Sprintf("  Bar total:%10.1f", s.PerBarTotal[i]))
+	}
+	fmt.Print("\033[0m")
+}
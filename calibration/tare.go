@@ -0,0 +1,70 @@
+package calibration
+
+// tareState holds the tare of a live test: per bar, the load cell weights
+// taken as the new zero (nil for bars without tare). Unlike re-zeroing it
+// leaves the zeros alone, so a fixture on one bar can be tared out without
+// disturbing the others.
+type tareState [][]float64
+
+func newTareState(nbars int) tareState {
+	return make(tareState, nbars)
+}
+
+// set tares bar i, or every bar when i < 0, at its readings in s. Bars that
+// did not answer in s are left as they are.
+func (t tareState) set(s *TestSnapshot, i int) {
+	for b := range t {
+		if (i >= 0 && b != i) || !s.PerBarOK[b] {
+			continue
+		}
+		t[b] = append([]float64(nil), s.Weight[b]...)
+	}
+}
+
+// clear removes the tare of every bar.
+func (t tareState) clear() {
+	for b := range t {
+		t[b] = nil
+	}
+}
+
+// active reports whether any bar is tared.
+func (t tareState) active() bool {
+	for _, w := range t {
+		if w != nil {
+			return true
+		}
+	}
+	return false
+}
+
+// apply returns s net of the tare, with Tared, PerBarGross and GrossTotal
+// filled in, or s itself when nothing is tared. s is not modified: RunLiveTest
+// reuses its readings for bars that stop answering.
+func (t tareState) apply(s *TestSnapshot) *TestSnapshot {
+	if !t.active() {
+		return s
+	}
+	net := *s
+	net.Weight = make([][]float64, len(s.Weight))
+	net.PerBarTotal = make([]float64, len(s.PerBarTotal))
+	net.Tared = make([]bool, len(s.PerBarTotal))
+	net.PerBarGross = append([]float64(nil), s.PerBarTotal...)
+	net.GrossTotal = s.GrandTotal
+	for b := range s.Weight {
+		net.Weight[b] = s.Weight[b]
+		net.PerBarTotal[b] = s.PerBarTotal[b]
+		if b < len(t) && t[b] != nil && len(t[b]) == len(s.Weight[b]) {
+			net.Tared[b] = true
+			net.Weight[b] = make([]float64, len(s.Weight[b]))
+			net.PerBarTotal[b] = 0
+			for lc, w := range s.Weight[b] {
+				net.Weight[b][lc] = w - t[b][lc]
+				net.PerBarTotal[b] += net.Weight[b][lc]
+			}
+		}
+	}
+	// bars that did not answer hold 0, or their last-known total when stale
+	net.GrandTotal = sumTotals(net.PerBarTotal)
+	return &net
+}
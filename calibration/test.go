@@ -1,13 +1,18 @@
 package calibration
 
 import (
-	"encoding/json"
+	"context"
+	"errors"
 	"fmt"
 	"log"
+	"math"
 	"os"
+	"path/filepath"
 	"strings"
+	"sync"
 	"time"
 
+	file "github.com/CK6170/Calrunrilla-go/file"
 	"github.com/CK6170/Calrunrilla-go/matrix"
 	serialpkg "github.com/CK6170/Calrunrilla-go/serial"
 	"github.com/CK6170/Calrunrilla-go/ui"
@@ -15,68 +20,124 @@ import (
 
 // testWeightsConfig loads parameters from a config and runs the interactive testWeights flow.
 func TestWeightsConfig(configPath string) {
-	jsonData, err := os.ReadFile(configPath)
+	loaded, err := file.LoadParameters(configPath)
 	if err != nil {
-		log.Fatalf("Error reading file: %v", err)
+		log.Fatalf("Invalid config %s:\n%v", configPath, err)
 	}
-	var parameters PARAMETERS
-	if err := json.Unmarshal(jsonData, &parameters); err != nil {
-		log.Fatalf("JSON error: %v", err)
+	parameters := *loaded
+	bars, err := ConnectWithRecovery(configPath, &parameters, false, printStatus)
+	if err != nil {
+		log.Fatalf("Cannot connect to the bars: %v", err)
 	}
-	if parameters.SERIAL == nil {
-		log.Fatal("Missing SERIAL section in JSON")
+	defer func() { _ = bars.Close() }()
+	warnVersions(bars, &parameters)
+	// If the config does not already carry factors, attempt to read them from the device.
+	factorSrc, err := EnsureFactorsFromDevice(bars, &parameters)
+	if err != nil {
+		log.Fatalf("Cannot read the factors from the bars: %v", err)
 	}
-	if parameters.SERIAL.PORT == "" {
-		p := serialpkg.AutoDetectPort(&parameters)
-		if p == "" {
-			log.Fatal("Could not auto-detect serial port for test")
+	ui.Debugf(parameters.DEBUG, "Using factors from %s\n", factorSrc)
+	TestWeights(bars, &parameters, configPath)
+}
+
+// FactorSource tells callers where the factors used for a test came from.
+type FactorSource string
+
+const (
+	FactorsFromFile   FactorSource = "file"
+	FactorsFromDevice FactorSource = "device"
+)
+
+// factorReadAttempts is how often a bar's factors are read before giving up;
+// the binary reply is occasionally truncated.
+const factorReadAttempts = 3
+
+// Default plausibility range for the magnitude of a factor read from a bar.
+const (
+	defaultFactorMin = 1e-6
+	defaultFactorMax = 1e2
+)
+
+// factorRange returns the configured plausibility range for factor magnitudes.
+func factorRange(parameters *PARAMETERS) (float64, float64) {
+	lo, hi := defaultFactorMin, defaultFactorMax
+	if t := parameters.TEST; t != nil {
+		if t.FACTORMIN > 0 {
+			lo = t.FACTORMIN
+		}
+		if t.FACTORMAX > 0 {
+			hi = t.FACTORMAX
 		}
-		parameters.SERIAL.PORT = p
 	}
-	bars := serialpkg.NewLeo485(parameters.SERIAL, parameters.BARS)
-	defer func() { _ = bars.Close() }()
-	if !ProbeVersion(bars, &parameters) {
-		log.Fatalf("ProbeVersion failed on %s", parameters.SERIAL.PORT)
+	return lo, hi
+}
+
+// checkFactors rejects factors that cannot come from a sane calibration:
+// non-finite or zero values, magnitudes outside lo..hi and mixed signs.
+func checkFactors(factors []float64, lo, hi float64) error {
+	if len(factors) == 0 {
+		return errors.New("no factors returned")
 	}
-	// If the config is not a calibrated file, attempt to read factors from the device.
-	if !strings.HasSuffix(strings.ToLower(configPath), "_calibrated.json") {
-		for i := 0; i < len(bars.Bars); i++ {
-			if factors, err := bars.ReadFactors(i); err == nil && len(factors) > 0 {
-				// populate parameters.BARS[i].LC with read factors (ignore total factor)
-				nlcs := len(factors)
-				parameters.BARS[i].LC = make([]*LC, nlcs)
-				for j := 0; j < nlcs; j++ {
-					parameters.BARS[i].LC[j] = &LC{ZERO: 0, FACTOR: float32(factors[j]), IEEE: fmt.Sprintf("%08X", matrix.ToIEEE754(float32(factors[j])))}
-				}
-				// factors were read and populated into parameters; do not print debug lines here
-			} else {
-				// show a warning so operator knows factors were not read
-				if err != nil {
-					// If the error contains a raw_hex dump (added by ReadFactors), print it for diagnostics
-					errorMsg := err.Error()
-					if strings.Contains(errorMsg, "raw_hex=") {
-						if parameters.DEBUG {
-							ui.Warningf("Warning: could not read factors from bar %d: %s\n", i+1, errorMsg)
-							// Also show a short suggestion to the user
-							ui.Warningf("Hint: please paste the raw_hex part when reporting this issue.\n")
-						} else {
-							ui.Warningf("Warning: could not read factors from bar %d: binary response unexpected (enable DEBUG for raw hex).\n", i+1)
-						}
-					} else {
-						ui.Warningf("Warning: could not read factors from bar %d: %v\n", i+1, err)
-					}
-				} else {
-					ui.Warningf("Warning: no factors returned from bar %d\n", i+1)
-				}
+	for j, f := range factors {
+		if math.IsNaN(f) || math.IsInf(f, 0) || f == 0 {
+			return fmt.Errorf("factor %d is %g", j, f)
+		}
+		if a := math.Abs(f); a < lo || a > hi {
+			return fmt.Errorf("factor %d is %g, outside %g..%g", j, f, lo, hi)
+		}
+		if (f < 0) != (factors[0] < 0) {
+			return fmt.Errorf("factor %d is %g but factor 0 is %g (mixed signs)", j, f, factors[0])
+		}
+	}
+	return nil
+}
+
+// EnsureFactorsFromDevice makes sure parameters carry factors for every bar.
+// When the loaded parameters are already calibrated (see
+// models.PARAMETERS.IsCalibrated) the file's factors are kept; otherwise the
+// factors are read from each bar, up to factorReadAttempts times, and checked
+// with checkFactors (range from TEST.FACTORMIN/FACTORMAX). A bar whose
+// factors cannot be read or are implausible is reported in the error.
+func EnsureFactorsFromDevice(bars *serialpkg.Leo485, parameters *PARAMETERS) (FactorSource, error) {
+	if parameters.IsCalibrated() {
+		return FactorsFromFile, nil
+	}
+	lo, hi := factorRange(parameters)
+	for i := 0; i < len(bars.Bars); i++ {
+		var factors []float64
+		var err error
+		for attempt := 1; attempt <= factorReadAttempts; attempt++ {
+			factors, err = bars.ReadFactors(i)
+			if err == nil {
+				err = checkFactors(factors, lo, hi)
 			}
+			if err == nil {
+				break
+			}
+			ui.Debugf(parameters.DEBUG, "Bar %d factors, attempt %d/%d: %v\n", i+1, attempt, factorReadAttempts, err)
+		}
+		if err != nil {
+			// The raw_hex dump added by ReadFactors is only useful with DEBUG on
+			if !parameters.DEBUG && strings.Contains(err.Error(), "raw_hex=") {
+				err = errors.New("binary response unexpected (enable DEBUG for raw hex)")
+			}
+			return FactorsFromDevice, fmt.Errorf("bar %d: %v; try reading the factors again", i+1, err)
+		}
+		// populate parameters.BARS[i].LC with read factors (ignore total factor)
+		nlcs := len(factors)
+		old := parameters.BARS[i].LC
+		parameters.BARS[i].LC = make([]*LC, nlcs)
+		for j := 0; j < nlcs; j++ {
+			parameters.BARS[i].LC[j] = &LC{ZERO: 0, FACTOR: float32(factors[j]), IEEE: matrix.FormatIEEEHex(float32(factors[j])), LABEL: lcLabel(old, j)}
 		}
-		// factors (if read from device) are printed once inside testWeights
 	}
-	TestWeights(bars, &parameters)
+	// factors (if read from device) are printed once inside testWeights
+	return FactorsFromDevice, nil
 }
 
 // testWeights shows factors, collects averaged zeros automatically, and displays a live weight table.
-func TestWeights(bars *serialpkg.Leo485, parameters *PARAMETERS) {
+// configPath is used to name recordings started from the live table.
+func TestWeights(bars *serialpkg.Leo485, parameters *PARAMETERS, configPath string) {
 	nbars := len(parameters.BARS)
 	if nbars == 0 {
 		log.Println("No bars configured for test")
@@ -88,7 +149,7 @@ func TestWeights(bars *serialpkg.Leo485, parameters *PARAMETERS) {
 		for i := 0; i < nbars; i++ {
 			nlcs := len(parameters.BARS[i].LC)
 			fmt.Println(matrix.MatrixLine)
-			fmt.Printf("Bar %d factors:\n", i+1)
+			fmt.Printf("%s factors:\n", parameters.BARS[i].Name(i))
 			for j := 0; j < nlcs; j++ {
 				f := parameters.BARS[i].LC[j].FACTOR
 				hex := parameters.BARS[i].LC[j].IEEE
@@ -100,127 +161,267 @@ func TestWeights(bars *serialpkg.Leo485, parameters *PARAMETERS) {
 		fmt.Print("\033[0m")
 	}
 
-	// auto collect averaged zeros
-	// Only show the green countdown line from collectAveragedZeros
-	flatZeros := collectAveragedZeros(bars, parameters, parameters.AVG)
-	nlcs := bars.NLCs
-	zerosPerBar := make([][]int64, nbars)
-	for i := 0; i < nbars; i++ {
-		zerosPerBar[i] = make([]int64, nlcs)
-		for j := 0; j < nlcs; j++ {
-			idx := i*nlcs + j
-			if idx < len(flatZeros) {
-				zerosPerBar[i][j] = flatZeros[idx]
+	// The live test runs on its own goroutine; this one handles the keys.
+	// mu guards the terminal output state and the recorder shared with it.
+	var mu sync.Mutex
+	lcsPerBar := bars.LCsPerBar()
+	barNames, _ := barLabels(bars, parameters)
+	totalLines := 3 + 3*nbars + bars.TotalLCs()
+	fresh := true // print the next table below the current output instead of over the last one
+	zerosShown := false
+	progressLines := 0          // lines of the zero collection progress currently on screen
+	var progressZeros [][]int64 // latest running zero estimates
+	// Optional recording of every snapshot, toggled with 'S'
+	var recorder *SnapshotRecorder
+	var last *TestSnapshot  // latest snapshot as read, tared with 't'/'T'
+	var shown *TestSnapshot // latest snapshot net of the tare, appended to the test log with 's'
+	var logged string       // confirmation of the last 's', shown below the header
+	tare := newTareState(nbars)
+	tarePending := false // 'T' was pressed and the bar number is awaited
+	stopRecording := func() {
+		if recorder != nil {
+			if err := recorder.Close(); err != nil {
+				log.Printf("Recording close error: %v", err)
 			}
+			recorder = nil
 		}
 	}
-
-	// print zeros
-	fmt.Print("\033[38;5;208m")
-	fmt.Println(matrix.MatrixLine)
-	fmt.Println("zeros (averaged)")
-	for i := 0; i < nbars; i++ {
-		fmt.Printf("Bar %d zeros:\n", i+1)
-		for j := 0; j < nlcs; j++ {
-			fmt.Printf("[%03d]  %12d\n", j, zerosPerBar[i][j])
+	onEvent := func(ev TestEvent) {
+		mu.Lock()
+		defer mu.Unlock()
+		switch ev.Kind {
+		case TestEventZerosProgress:
+			if ev.Progress.Current != nil {
+				progressZeros = ev.Progress.Current
+			}
+			progressLines = printZeroProgress(ev.Progress, progressZeros, barNames, progressLines)
+			return
+		case TestEventZeros:
+			progressLines, progressZeros = 0, nil
+			// zeros are printed once; re-zeroing is silent apart from the countdown
+			if !zerosShown {
+				printZeros(ev.Zeros, barNames)
+				zerosShown = true
+			}
+		case TestEventStatus:
+			printStatus(ev.Message)
+		default:
+			// stable/unstable, bar dropouts and overloads are shown on the table itself
+			return
 		}
-		fmt.Println(matrix.MatrixLine)
+		fresh = true
+	}
+	onSnapshot := func(snap *TestSnapshot) {
+		mu.Lock()
+		defer mu.Unlock()
+		if !fresh {
+			fmt.Printf("\033[%dA", totalLines)
+		}
+		fresh = false
+		last = snap
+		shown = tare.apply(snap)
+		printSnapshot(shown, testHeader(recorder), tareStatus(tare, tarePending, logged, barNames), parameters)
+		if recorder != nil {
+			if err := recorder.Record(shown); err != nil {
+				log.Printf("Recording error: %v", err)
+				stopRecording()
+				fresh = true
+			}
+		}
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	rezero := make(chan struct{}, 1)
+	done := make(chan error, 1)
+	go func() {
+		done <- RunLiveTest(ctx, bars, parameters, LiveTestOptions{Rezero: rezero}, onSnapshot, onEvent)
+	}()
+	stop := func() {
+		cancel()
+		<-done
+		mu.Lock()
+		stopRecording()
+		mu.Unlock()
 	}
-	fmt.Print("\033[0m")
 
-	// live display: show an initial one-shot snapshot so the user always sees
-	// the weight table even if subsequent in-place updates behave oddly.
-	printWeightSnapshot(bars, zerosPerBar, parameters)
 	ui.DrainKeys()
 	keyEvents := ui.StartKeyEvents()
-	firstPrint := false
-	lineWidth := 80
-	linesPerBar := nlcs + 3
-	totalLines := 3 + nbars*linesPerBar
 	for {
-		if !firstPrint {
-			fmt.Printf("\033[%dA", totalLines)
+		k, ok := <-keyEvents
+		if !ok {
+			// keyboard gone: nothing can end the test any more
+			stop()
+			return
 		}
-		firstPrint = false
-		header := "Weight check results (press 'R' to Recalibrate, 'Z' to Re-zero, <ESC> to exit):"
-		fmt.Printf("\033[92m%-80s\033[0m\n\n", header)
-		grandTotal := 0.0
-		for i := 0; i < nbars; i++ {
-			fmt.Printf("%-80s\n", fmt.Sprintf("Bar %d:", i+1))
-			barTotal := 0.0
-			ad, err := bars.GetADs(i)
-			if err != nil {
-				log.Printf("Bar %d read error: %v", i+1, err)
+		if k == 'R' || k == 'r' {
+			stop()
+			immediateRetry = true
+			return
+		}
+		mu.Lock()
+		if tarePending {
+			tarePending = false
+			if i, ok := tareBar(k, nbars); ok {
+				if last != nil {
+					tare.set(last, i)
+				}
+				mu.Unlock()
 				continue
 			}
-			for lc := 0; lc < nlcs; lc++ {
-				adc := int64(0)
-				if lc < len(ad) {
-					adc = int64(ad[lc])
-				}
-				zero := float64(0)
-				factor := float64(1)
-				// Prefer collected zeros from the interactive test (zerosPerBar) when available.
-				if i < len(zerosPerBar) && lc < len(zerosPerBar[i]) {
-					zero = float64(zerosPerBar[i][lc])
-					if lc < len(parameters.BARS[i].LC) {
-						factor = float64(parameters.BARS[i].LC[lc].FACTOR)
-					}
-				} else if lc < len(parameters.BARS[i].LC) {
-					zero = float64(parameters.BARS[i].LC[lc].ZERO)
-					factor = float64(parameters.BARS[i].LC[lc].FACTOR)
-				}
-				w := (float64(adc) - zero) * factor
-				barTotal += w
-				var line string
-				if w >= 0 {
-					line = fmt.Sprintf("  LC %2d:     \033[32mW=%7.1f\033[0m  ADC=%12d", lc+1, w, adc)
-				} else {
-					line = fmt.Sprintf("  LC %2d:     \033[31mW=%7.1f\033[0m  ADC=%12d", lc+1, w, adc)
-				}
-				fmt.Printf("%-*s\n", lineWidth, line)
+			// any other key drops the pending tare and does its usual job
+		}
+		switch k {
+		case 't':
+			if last != nil {
+				tare.set(last, -1)
 			}
-			bt := fmt.Sprintf("  \033[33mBar total:%10.1f\033[0m", barTotal)
-			fmt.Printf("%-*s\n\n", lineWidth, bt)
-			grandTotal += barTotal
+		case 'T':
+			tarePending = true
+		case 'u', 'U', 'Z', 'z':
+			// new zeros make the tare meaningless, so re-zeroing clears it too
+			tare.clear()
 		}
-		gt := fmt.Sprintf("\033[36mGrand total:%10.1f\033[0m", grandTotal)
-		fmt.Printf("%-*s\n", lineWidth, gt)
-
-		select {
-		case k := <-keyEvents:
-			if k == 'R' || k == 'r' {
-				immediateRetry = true
-				return
+		mu.Unlock()
+		if k == 'Z' || k == 'z' {
+			// re-collect zeros; ignored if a re-zero is already pending
+			select {
+			case rezero <- struct{}{}:
+			default:
 			}
-			if k == 'Z' || k == 'z' {
-				// re-collect zeros silently and force header refresh
-				newZeros := collectAveragedZeros(bars, parameters, parameters.AVG)
-				for i := 0; i < nbars; i++ {
-					for j := 0; j < nlcs; j++ {
-						idx := i*nlcs + j
-						if idx < len(newZeros) {
-							zerosPerBar[i][j] = newZeros[idx]
-						}
-					}
+			continue
+		}
+		if k == 's' {
+			mu.Lock()
+			if shown != nil {
+				path := snapshotLogPath(configPath)
+				if err := appendSnapshot(path, lcsPerBar, shown); err != nil {
+					log.Printf("Cannot log snapshot: %v", err)
+					fresh = true
+				} else {
+					logged = fmt.Sprintf("Snapshot of %s logged to %s", shown.Time.Format("15:04:05"), filepath.Base(path))
 				}
-				firstPrint = true
-				continue
 			}
-			if k == 27 {
-				os.Exit(0)
+			mu.Unlock()
+			continue
+		}
+		if k == 'S' {
+			mu.Lock()
+			if recorder != nil {
+				stopRecording()
+			} else if r, err := NewSnapshotRecorder(recordingPath(configPath), lcsPerBar, defaultRecordingMaxBytes); err != nil {
+				log.Printf("Cannot start recording: %v", err)
+				fresh = true
+			} else {
+				recorder = r
 			}
-		default:
-			time.Sleep(250 * time.Millisecond)
+			mu.Unlock()
+			continue
+		}
+		if k == 27 {
+			stop()
+			os.Exit(0)
 		}
 	}
 }
 
-// collectAveragedZeros samples ADCs and returns averaged values
-func collectAveragedZeros(bars *serialpkg.Leo485, parameters *PARAMETERS, samples int) []int64 {
+// printZeros prints the averaged zeros collected at the start of a test.
+func printZeros(zerosPerBar [][]int64, names []string) {
+	fmt.Print("\033[38;5;208m")
+	fmt.Println(matrix.MatrixLine)
+	fmt.Println("zeros (averaged)")
+	for i, zeros := range zerosPerBar {
+		fmt.Printf("%s zeros:\n", names[i])
+		for j, z := range zeros {
+			fmt.Printf("[%03d]  %12d\n", j, z)
+		}
+		fmt.Println(matrix.MatrixLine)
+	}
+	fmt.Print("\033[0m")
+}
+
+// printZeroProgress redraws the zero collection countdown and the running
+// zero estimates over the lines printed by the previous call and returns the
+// number of lines printed.
+func printZeroProgress(p *ZeroProgress, current [][]int64, names []string, lines int) int {
+	if lines > 0 {
+		fmt.Printf("\033[%dA", lines)
+	}
+	fmt.Printf("\r\033[92mCollecting zeros: %d/%d remaining...\033[0m\033[K\n", p.Samples-p.Sample, p.Samples)
+	fmt.Print("\033[38;5;208m")
+	for i, zeros := range current {
+		fmt.Printf("%s:", names[i])
+		for _, z := range zeros {
+			fmt.Printf(" %12d", z)
+		}
+		fmt.Print("\033[K\n")
+	}
+	fmt.Print("\033[0m")
+	return 1 + len(current)
+}
+
+// testHeader is the key legend shown above the live weight table.
+func testHeader(recorder *SnapshotRecorder) string {
+	header := "Weight check (R=Recal, Z=Zero, t/T=Tare, u=Untare, s=Log, S=Rec, <ESC>):"
+	if recorder != nil {
+		header += " [REC]"
+	}
+	return header
+}
+
+// tareStatus returns the line shown below the test header: the prompt for the
+// bar to tare after 'T', else the tared bars and the last 's' confirmation.
+func tareStatus(tare tareState, pending bool, logged string, barNames []string) string {
+	if pending {
+		return fmt.Sprintf("Tare which bar? (1-%d)", len(tare))
+	}
+	var tared []string
+	for i, w := range tare {
+		if w != nil {
+			tared = append(tared, barNames[i])
+		}
+	}
+	if len(tared) == 0 {
+		return logged
+	}
+	status := "[TARED] " + strings.Join(tared, ", ")
+	if logged != "" {
+		status += "; " + logged
+	}
+	if len(status) > 80 {
+		status = status[:77] + "..."
+	}
+	return status
+}
+
+// tareBar returns the 0-based bar selected by key k after 'T', and false
+// when k is not the number of one of the nbars bars.
+func tareBar(k rune, nbars int) (int, bool) {
+	i := int(k - '1')
+	if k < '1' || k > '9' || i >= nbars {
+		return 0, false
+	}
+	return i, true
+}
+
+// defaultZeroProgressEvery is used when PARAMETERS.TEST.ZEROEVERY is unset.
+const defaultZeroProgressEvery = 5
+
+// ZeroProgress reports the progress of a zero collection. Current holds the
+// running per bar, per LC averages; to keep updates small it is only filled
+// every TEST.ZEROEVERY samples and on the last one.
+type ZeroProgress struct {
+	Sample  int // samples taken so far
+	Samples int
+	Current [][]int64
+}
+
+// collectAveragedZeros samples ADCs and returns averaged values. When
+// onProgress is nil the countdown is printed on the terminal, otherwise it is
+// reported through onProgress after every sample.
+func collectAveragedZeros(bars *serialpkg.Leo485, parameters *PARAMETERS, samples int, onProgress func(ZeroProgress)) []int64 {
 	nb := len(bars.Bars)
-	nlcs := bars.NLCs
-	sums := make([]int64, nb*nlcs)
+	readings := make([][]int64, bars.TotalLCs()) // per LC, one value per valid sample
 	count := 0
 	// Warm-up/ignore: use IGNORE from parameters when available (fall back to 5)
 	warmup := 5
@@ -229,6 +430,10 @@ func collectAveragedZeros(bars *serialpkg.Leo485, parameters *PARAMETERS, sample
 	}
 	// Print a short warming-up message (magenta) which will be overwritten by the green countdown
 	fmt.Printf("\r\033[95mWarming up: %d quick samples...\033[0m\n", warmup)
+	every := defaultZeroProgressEvery
+	if parameters != nil && parameters.TEST != nil && parameters.TEST.ZEROEVERY > 0 {
+		every = parameters.TEST.ZEROEVERY
+	}
 	for w := 0; w < warmup; w++ {
 		for i := 0; i < nb; i++ {
 			_, _ = bars.GetADs(i)
@@ -242,9 +447,11 @@ func collectAveragedZeros(bars *serialpkg.Leo485, parameters *PARAMETERS, sample
 		if remaining < 0 {
 			remaining = 0
 		}
-		fmt.Printf("\r\033[92mCollecting zeros: %d/%d remaining...\033[0m ", remaining, samples)
-		if s == samples-1 {
-			fmt.Printf("\n")
+		if onProgress == nil {
+			fmt.Printf("\r\033[92mCollecting zeros: %d/%d remaining...\033[0m ", remaining, samples)
+			if s == samples-1 {
+				fmt.Printf("\n")
+			}
 		}
 		// Only consider this iteration a valid sample if we received at least one ADC reading
 		gotAny := false
@@ -254,22 +461,29 @@ func collectAveragedZeros(bars *serialpkg.Leo485, parameters *PARAMETERS, sample
 				continue
 			}
 			gotAny = true
-			for lc := 0; lc < nlcs; lc++ {
+			for lc := 0; lc < bars.NLCsPerBar(i); lc++ {
 				val := int64(0)
 				if lc < len(ad) {
 					val = int64(ad[lc])
 				}
-				idx := i*nlcs + lc
-				sums[idx] += val
+				idx := bars.LCOffset(i) + lc
+				readings[idx] = append(readings[idx], val)
 			}
 		}
 		if gotAny {
 			count++
 		}
+		if onProgress != nil {
+			p := ZeroProgress{Sample: s + 1, Samples: samples}
+			if count > 0 && ((s+1)%every == 0 || s == samples-1) {
+				p.Current = splitPerBar(truncatedMeans(readings), bars.LCsPerBar())
+			}
+			onProgress(p)
+		}
 		time.Sleep(5 * time.Millisecond)
 	}
-	avg := make([]int64, nb*nlcs)
 	if count == 0 {
+		avg := make([]int64, len(readings))
 		// If we collected no valid samples, try a one-shot read to fill zeros
 		if parameters != nil && parameters.DEBUG {
 			ui.Debugf(true, "No valid averaging samples collected; performing one-shot read for zeros\n")
@@ -281,8 +495,8 @@ func collectAveragedZeros(bars *serialpkg.Leo485, parameters *PARAMETERS, sample
 				continue
 			}
 			any = true
-			for lc := 0; lc < nlcs; lc++ {
-				idx := i*nlcs + lc
+			for lc := 0; lc < bars.NLCsPerBar(i); lc++ {
+				idx := bars.LCOffset(i) + lc
 				if lc < len(ad) {
 					avg[idx] = int64(ad[lc])
 				} else {
@@ -295,59 +509,5 @@ func collectAveragedZeros(bars *serialpkg.Leo485, parameters *PARAMETERS, sample
 		}
 		return avg
 	}
-	for i := range sums {
-		avg[i] = sums[i] / int64(count)
-	}
-	return avg
-}
-
-// printWeightSnapshot prints a single snapshot of the weight table (same format
-// used in the live loop) so the operator sees initial values immediately.
-func printWeightSnapshot(bars *serialpkg.Leo485, zerosPerBar [][]int64, parameters *PARAMETERS) {
-	nbars := len(parameters.BARS)
-	nlcs := bars.NLCs
-	lineWidth := 80
-	header := "Weight check results (press 'R' to Recalibrate, 'Z' to Re-zero, <ESC> to exit):"
-	fmt.Printf("\033[92m%-80s\033[0m\n\n", header)
-	grandTotal := 0.0
-	for i := 0; i < nbars; i++ {
-		fmt.Printf("%-80s\n", fmt.Sprintf("Bar %d:", i+1))
-		barTotal := 0.0
-		ad, err := bars.GetADs(i)
-		if err != nil {
-			log.Printf("Bar %d read error: %v", i+1, err)
-			continue
-		}
-		for lc := 0; lc < nlcs; lc++ {
-			adc := int64(0)
-			if lc < len(ad) {
-				adc = int64(ad[lc])
-			}
-			zero := float64(0)
-			factor := float64(1)
-			if i < len(zerosPerBar) && lc < len(zerosPerBar[i]) {
-				zero = float64(zerosPerBar[i][lc])
-				if lc < len(parameters.BARS[i].LC) {
-					factor = float64(parameters.BARS[i].LC[lc].FACTOR)
-				}
-			} else if lc < len(parameters.BARS[i].LC) {
-				zero = float64(parameters.BARS[i].LC[lc].ZERO)
-				factor = float64(parameters.BARS[i].LC[lc].FACTOR)
-			}
-			w := (float64(adc) - zero) * factor
-			barTotal += w
-			var line string
-			if w >= 0 {
-				line = fmt.Sprintf("  LC %2d:     \033[32mW=%7.1f\033[0m  ADC=%12d", lc+1, w, adc)
-			} else {
-				line = fmt.Sprintf("  LC %2d:     \033[31mW=%7.1f\033[0m  ADC=%12d", lc+1, w, adc)
-			}
-			fmt.Printf("%*s\n", -lineWidth, line)
-		}
-		bt := fmt.Sprintf("  \033[33mBar total:%10.1f\033[0m", barTotal)
-		fmt.Printf("%*s\n\n", -lineWidth, bt)
-		grandTotal += barTotal
-	}
-	gt := fmt.Sprintf("\033[36mGrand total:%10.1f\033[0m", grandTotal)
-	fmt.Printf("%*s\n", -lineWidth, gt)
+	return truncatedMeans(readings)
 }
@@ -1,10 +1,16 @@
 package file
 
 import (
+	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"reflect"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/CK6170/Calrunrilla-go/matrix"
 	models "github.com/CK6170/Calrunrilla-go/models"
@@ -18,38 +24,236 @@ type VERSION = models.VERSION
 type SERIAL = models.SERIAL
 type BAR = models.BAR
 type LC = models.LC
+type META = models.META
 
-// persistParameters overwrites original JSON with updated parameters (including detected port)
+// LoadParameters reads and validates a config or calibrated JSON file. All
+// problems are reported together, each naming the JSON path of the offending
+// field (see models.PARAMETERS.Validate).
+func LoadParameters(path string) (*PARAMETERS, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, err
+	}
+	data, err = migrate(data)
+	if err != nil {
+		return nil, err
+	}
+	var parameters PARAMETERS
+	if err := json.Unmarshal(data, &parameters); err != nil {
+		return nil, fmt.Errorf("JSON error: %v", err)
+	}
+	var errs []error
+	// SERIAL is small and fully owned by us, so reject unknown keys there
+	// (typically a misspelled PORT or BAUDRATE).
+	var raw struct {
+		SERIAL json.RawMessage `json:"SERIAL"`
+	}
+	if err := json.Unmarshal(data, &raw); err == nil && len(raw.SERIAL) > 0 && string(raw.SERIAL) != "null" {
+		dec := json.NewDecoder(bytes.NewReader(raw.SERIAL))
+		dec.DisallowUnknownFields()
+		var ser SERIAL
+		if err := dec.Decode(&ser); err != nil {
+			errs = append(errs, &models.ValidationError{Path: "SERIAL", Message: err.Error()})
+		}
+	}
+	if err := parameters.Validate(); err != nil {
+		errs = append(errs, err)
+	}
+	if len(errs) > 0 {
+		return nil, errors.Join(errs...)
+	}
+	repairIEEE(&parameters)
+	if err := applyOverrides(&parameters); err != nil {
+		return nil, err
+	}
+	return &parameters, nil
+}
+
+// Environment variables overriding SERIAL.PORT and SERIAL.BAUDRATE, e.g. for
+// containers with mapped devices. The CLI -port and -baud flags set them too.
+const (
+	PortEnv = "CALRUNRILLA_PORT"
+	BaudEnv = "CALRUNRILLA_BAUD"
+)
+
+// applyOverrides replaces SERIAL.PORT and SERIAL.BAUDRATE with PortEnv and
+// BaudEnv when set, keeping the file's values in FILESERIAL.
+func applyOverrides(parameters *PARAMETERS) error {
+	port, baud := os.Getenv(PortEnv), os.Getenv(BaudEnv)
+	if port == "" && baud == "" {
+		return nil
+	}
+	orig := *parameters.SERIAL
+	ser := orig
+	if port != "" {
+		ser.PORT = port
+	}
+	if baud != "" {
+		n, err := strconv.Atoi(baud)
+		if err != nil || n <= 0 {
+			return fmt.Errorf("%s must be a positive baud rate, got %q", BaudEnv, baud)
+		}
+		ser.BAUDRATE = n
+	}
+	parameters.SERIAL = &ser
+	parameters.FILESERIAL = &orig
+	return nil
+}
+
+// migrate upgrades data to the current SCHEMA (see models.Migrate). Files
+// already at the current schema are returned unchanged.
+func migrate(data []byte) ([]byte, error) {
+	// json.Number keeps integers such as wrapped-around zeros exact
+	dec := json.NewDecoder(bytes.NewReader(data))
+	dec.UseNumber()
+	var raw map[string]interface{}
+	if err := dec.Decode(&raw); err != nil {
+		return nil, fmt.Errorf("JSON error: %v", err)
+	}
+	if dec.More() {
+		return nil, fmt.Errorf("JSON error: unexpected data after the top-level object")
+	}
+	from, err := models.Migrate(raw)
+	if err != nil {
+		return nil, err
+	}
+	if from == models.SchemaVersion {
+		return data, nil
+	}
+	return json.Marshal(raw)
+}
+
+// repairIEEE makes every LC's IEEE field match its FACTOR. FACTOR is what
+// gets flashed and used for weights, so a missing, malformed or different IEEE
+// value is rewritten from it (with a warning unless the field was empty).
+func repairIEEE(parameters *PARAMETERS) {
+	for i, bar := range parameters.BARS {
+		if bar == nil {
+			continue
+		}
+		for j, lc := range bar.LC {
+			if lc == nil {
+				continue
+			}
+			want := matrix.FormatIEEEHex(lc.FACTOR)
+			if lc.IEEE == "" {
+				lc.IEEE = want
+				continue
+			}
+			f, err := matrix.ParseIEEEHex(lc.IEEE)
+			switch {
+			case err != nil:
+				ui.Warningf("Warning: BARS[%d].LC[%d]: %v; using %s from FACTOR\n", i, j, err, want)
+			case matrix.ToIEEE754(f) != matrix.ToIEEE754(lc.FACTOR):
+				ui.Warningf("Warning: BARS[%d].LC[%d]: IEEE %s (%g) does not match FACTOR %g; using %s\n", i, j, lc.IEEE, f, lc.FACTOR, want)
+			}
+			lc.IEEE = want
+		}
+	}
+}
+
+// PersistParameters writes parameters (including a detected port) back to
+// the config file at path. The original text is patched in place (see
+// patchJSON), so keys PARAMETERS does not know, the key order and the
+// formatting survive and only the changed values differ. A missing or
+// unreadable original is rewritten in full. The file is replaced atomically
+// so an interrupted write cannot truncate it.
 func PersistParameters(path string, parameters *PARAMETERS) {
-	data, err := json.MarshalIndent(parameters, "", "  ")
+	if parameters.FILESERIAL != nil {
+		ui.Debugf(parameters.DEBUG, "Serial settings overridden; %s left unchanged\n", path)
+		return
+	}
+	parameters.SCHEMA = models.SchemaVersion
+	data, err := json.Marshal(parameters)
+	if err != nil {
+		fmt.Println("Cannot marshal parameters:", err)
+		return
+	}
+	out, err := patchedOrIndented(path, data, reflect.TypeOf(parameters))
 	if err != nil {
 		fmt.Println("Cannot marshal parameters:", err)
 		return
 	}
-	if writeErr := os.WriteFile(path, data, 0644); writeErr != nil {
+	if writeErr := writeFileAtomic(path, out, 0644); writeErr != nil {
 		fmt.Println("Cannot write parameters file:", writeErr)
 	}
 }
-func SaveToJSON(file string, parameters *PARAMETERS, appVer string, appBuild string) {
+
+// patchedOrIndented returns the file at path patched to data (the encoding of
+// a value of type t), or data indented when the file cannot be patched.
+func patchedOrIndented(path string, data []byte, t reflect.Type) ([]byte, error) {
+	if original, err := os.ReadFile(path); err == nil {
+		patched, patchErr := patchJSON(original, data, t)
+		if patchErr == nil {
+			return patched, nil
+		}
+		ui.Warningf("Warning: cannot patch %s, rewriting it: %v\n", path, patchErr)
+	}
+	var indented bytes.Buffer
+	if err := json.Indent(&indented, data, "", "  "); err != nil {
+		return nil, err
+	}
+	return indented.Bytes(), nil
+}
+
+// CalibratedPath returns the stable calibrated file name for a config,
+// e.g. config.json -> config_calibrated.json.
+func CalibratedPath(configPath string) string {
+	return strings.TrimSuffix(configPath, ".json") + "_calibrated.json"
+}
+
+// VersionedCalibratedPath returns a timestamped calibrated file name,
+// e.g. config.json -> config_calibrated_20240311-1542.json.
+func VersionedCalibratedPath(configPath string, t time.Time) string {
+	return strings.TrimSuffix(configPath, ".json") + "_calibrated_" + t.Format("20060102-1504") + ".json"
+}
+
+// SaveCalibratedJSON saves the calibrated parameters for configPath to the
+// stable CalibratedPath. When parameters.VERSIONED is set a timestamped copy
+// is written first and its name returned as versioned (empty otherwise).
+func SaveCalibratedJSON(configPath string, parameters *PARAMETERS, appVer string, appBuild string) (stable string, versioned string, err error) {
+	stable = CalibratedPath(configPath)
+	if parameters.VERSIONED {
+		versioned = VersionedCalibratedPath(configPath, time.Now())
+		if err := SaveToJSON(versioned, parameters, appVer, appBuild); err != nil {
+			return stable, "", err
+		}
+	}
+	return stable, versioned, SaveToJSON(stable, parameters, appVer, appBuild)
+}
+
+// SaveToJSON writes the calibrated payload to file together with an adjacent
+// .version file. Errors are printed as warnings and returned.
+func SaveToJSON(file string, parameters *PARAMETERS, appVer string, appBuild string) error {
 	// Build a small payload that includes SERIAL, BARS and desired runtime
 	// defaults so the saved _calibrated.json contains AVG, IGNORE and DEBUG.
 	payload := struct {
-		SERIAL *SERIAL `json:"SERIAL"`
-		BARS   []*BAR  `json:"BARS"`
-		AVG    int     `json:"AVG"`
-		IGNORE int     `json:"IGNORE"`
-		DEBUG  bool    `json:"DEBUG"`
+		SCHEMA   int              `json:"SCHEMA"`
+		SERIAL   *SERIAL          `json:"SERIAL"`
+		SHELF    string           `json:"SHELF,omitempty"`
+		CAPACITY float64          `json:"CAPACITY,omitempty"`
+		GEOMETRY *models.GEOMETRY `json:"GEOMETRY,omitempty"`
+		BARS     []*BAR           `json:"BARS"`
+		AVG      int              `json:"AVG"`
+		IGNORE   int              `json:"IGNORE"`
+		DEBUG    bool             `json:"DEBUG"`
+		META     *META            `json:"META"`
 	}{
-		SERIAL: parameters.SERIAL,
-		BARS:   parameters.BARS,
-		AVG:    parameters.AVG,
-		IGNORE: parameters.IGNORE,
-		DEBUG:  parameters.DEBUG,
+		SCHEMA:   models.SchemaVersion,
+		SHELF:    parameters.SHELF,
+		CAPACITY: parameters.CAPACITY,
+		GEOMETRY: parameters.GEOMETRY,
+		SERIAL:   fileSerial(parameters),
+		BARS:     parameters.BARS,
+		AVG:      parameters.AVG,
+		IGNORE:   parameters.IGNORE,
+		DEBUG:    parameters.DEBUG,
+		META:     newMeta(parameters, appVer, appBuild),
 	}
 	data, _ := json.MarshalIndent(payload, "", "  ")
-	if err := os.WriteFile(file, data, 0644); err != nil {
+	if err := writeWithBackups(file, data, 0644); err != nil {
 		ui.Warningf("Warning: failed to write JSON file: %v\n", err)
-		return
+		return err
 	}
 	ui.Greenf("%s Saved\n", file)
 
@@ -58,9 +262,130 @@ func SaveToJSON(file string, parameters *PARAMETERS, appVer string, appBuild str
 	verFile := strings.TrimSuffix(file, ".json") + ".version"
 	// Write version file as two tokens so CI/builds can inject numeric values
 	verContent := fmt.Sprintf("%s %s\n", appVer, appBuild)
-	if err := os.WriteFile(verFile, []byte(verContent), 0644); err != nil {
+	if err := writeFileAtomic(verFile, []byte(verContent), 0644); err != nil {
 		ui.Warningf("Warning: failed to write version file: %v\n", err)
 	}
+	return nil
+}
+
+// fileSerial returns the SERIAL block to save: the file's own when it was
+// overridden at load time.
+func fileSerial(parameters *PARAMETERS) *SERIAL {
+	if parameters.FILESERIAL != nil {
+		return parameters.FILESERIAL
+	}
+	return parameters.SERIAL
+}
+
+// keepBackups is the number of previous calibrated files kept by SaveToJSON
+// (name.bak, name.bak.1, ...).
+const keepBackups = 3
+
+// rename is os.Rename; tests replace it to simulate failed or interrupted writes.
+var rename = os.Rename
+
+// writeFileAtomic writes data to a temporary file in the same directory,
+// syncs it and renames it over path, so a crash mid-write never leaves a
+// truncated file behind. On error the original file is untouched.
+func writeFileAtomic(path string, data []byte, perm os.FileMode) error {
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".tmp*")
+	if err != nil {
+		return err
+	}
+	tmpName := tmp.Name()
+	if _, err := tmp.Write(data); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmpName)
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		_ = tmp.Close()
+		_ = os.Remove(tmpName)
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		_ = os.Remove(tmpName)
+		return err
+	}
+	if err := os.Chmod(tmpName, perm); err != nil {
+		_ = os.Remove(tmpName)
+		return err
+	}
+	if err := rename(tmpName, path); err != nil {
+		_ = os.Remove(tmpName)
+		return err
+	}
+	return nil
+}
+
+// SaveReport writes v (a test report) as indented JSON to path.
+func SaveReport(path string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return err
+	}
+	return writeFileAtomic(path, data, 0644)
+}
+
+// writeWithBackups behaves like writeFileAtomic but keeps the file it
+// replaces as path.bak, shifting older backups up to keepBackups copies. The
+// current file is first linked (or copied) to path.bak.tmp; the backups are
+// only rotated once the new data has been renamed over path, so a failed or
+// interrupted write leaves both path and the existing backups untouched.
+func writeWithBackups(path string, data []byte, perm os.FileMode) error {
+	if _, err := os.Stat(path); err != nil {
+		return writeFileAtomic(path, data, perm)
+	}
+	backupName := func(n int) string {
+		if n == 0 {
+			return path + ".bak"
+		}
+		return fmt.Sprintf("%s.bak.%d", path, n)
+	}
+	prev := path + ".bak.tmp"
+	_ = os.Remove(prev) // left over from an interrupted write
+	if err := os.Link(path, prev); err != nil {
+		// no hard links on this file system: copy instead
+		old, readErr := os.ReadFile(path)
+		if readErr != nil {
+			return readErr
+		}
+		if err := writeFileAtomic(prev, old, perm); err != nil {
+			return err
+		}
+	}
+	if err := writeFileAtomic(path, data, perm); err != nil {
+		_ = os.Remove(prev)
+		return err
+	}
+	_ = os.Remove(backupName(keepBackups - 1))
+	for n := keepBackups - 2; n >= 0; n-- {
+		if _, err := os.Stat(backupName(n)); err == nil {
+			_ = rename(backupName(n), backupName(n+1))
+		}
+	}
+	if err := rename(prev, backupName(0)); err != nil {
+		// the new file is in place; only its backup is missing
+		ui.Warningf("Warning: cannot keep the previous %s as %s: %v\n", path, backupName(0), err)
+	}
+	return nil
+}
+
+// newMeta returns the META block for a saved file: a copy of the
+// calibration details already recorded on parameters (if any) stamped with
+// the creation time, app version and serial port.
+func newMeta(parameters *PARAMETERS, appVer string, appBuild string) *META {
+	meta := &META{}
+	if parameters.META != nil {
+		*meta = *parameters.META
+	}
+	meta.CREATED = time.Now().Format(time.RFC3339)
+	meta.APPVERSION = appVer
+	meta.APPBUILD = appBuild
+	if parameters.SERIAL != nil {
+		meta.PORT = parameters.SERIAL.PORT
+	}
+	return meta
 }
 
 func AppendToFile(file, content string) {
@@ -0,0 +1,240 @@
+package file
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	models "github.com/CK6170/Calrunrilla-go/models"
+)
+
+func readString(t *testing.T, path string) string {
+	t.Helper()
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatalf("read %s: %v", path, err)
+	}
+	return string(data)
+}
+
+func assertMissing(t *testing.T, path string) {
+	t.Helper()
+	if _, err := os.Stat(path); !os.IsNotExist(err) {
+		t.Errorf("%s exists, want it missing (err=%v)", path, err)
+	}
+}
+
+// assertOnlyFiles fails when dir holds files other than names.
+func assertOnlyFiles(t *testing.T, dir string, names ...string) {
+	t.Helper()
+	want := make(map[string]bool)
+	for _, n := range names {
+		want[n] = true
+	}
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, e := range entries {
+		if !want[e.Name()] {
+			t.Errorf("unexpected file %s", e.Name())
+		}
+	}
+}
+
+// writeVersions writes each of versions to path in turn.
+func writeVersions(t *testing.T, path string, versions ...string) {
+	t.Helper()
+	for _, v := range versions {
+		if err := writeWithBackups(path, []byte(v), 0644); err != nil {
+			t.Fatalf("write %q: %v", v, err)
+		}
+	}
+}
+
+func TestWriteWithBackupsRotates(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "cal.json")
+	writeVersions(t, path, "v0", "v1", "v2", "v3", "v4")
+
+	for name, want := range map[string]string{
+		path:            "v4",
+		path + ".bak":   "v3",
+		path + ".bak.1": "v2",
+		path + ".bak.2": "v1",
+	} {
+		if got := readString(t, name); got != want {
+			t.Errorf("%s = %q, want %q", filepath.Base(name), got, want)
+		}
+	}
+	assertOnlyFiles(t, dir, "cal.json", "cal.json.bak", "cal.json.bak.1", "cal.json.bak.2")
+}
+
+func TestWriteWithBackupsFailedWrite(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "cal.json")
+	writeVersions(t, path, "v0", "v1")
+
+	rename = func(oldpath, newpath string) error {
+		if newpath == path {
+			return errors.New("disk full")
+		}
+		return os.Rename(oldpath, newpath)
+	}
+	t.Cleanup(func() { rename = os.Rename })
+
+	if err := writeWithBackups(path, []byte("v2"), 0644); err == nil {
+		t.Fatal("write succeeded, want the rename error")
+	}
+	if got := readString(t, path); got != "v1" {
+		t.Errorf("file = %q, want v1 untouched", got)
+	}
+	if got := readString(t, path+".bak"); got != "v0" {
+		t.Errorf(".bak = %q, want v0 untouched", got)
+	}
+	assertMissing(t, path+".bak.1")
+	assertOnlyFiles(t, dir, "cal.json", "cal.json.bak")
+}
+
+func TestWriteWithBackupsInterruptedWrite(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "cal.json")
+	writeVersions(t, path, "v0", "v1")
+
+	// stop the write where the new file would replace the old one
+	type crash struct{}
+	rename = func(oldpath, newpath string) error {
+		if newpath == path {
+			panic(crash{})
+		}
+		return os.Rename(oldpath, newpath)
+	}
+	func() {
+		defer func() {
+			if r := recover(); r != (crash{}) {
+				t.Fatalf("recovered %v, want the simulated crash", r)
+			}
+		}()
+		_ = writeWithBackups(path, []byte("v2"), 0644)
+	}()
+	rename = os.Rename
+
+	if got := readString(t, path); got != "v1" {
+		t.Errorf("file after crash = %q, want v1", got)
+	}
+	if got := readString(t, path+".bak"); got != "v0" {
+		t.Errorf(".bak after crash = %q, want v0", got)
+	}
+
+	// the next write recovers and leaves no staging files behind
+	writeVersions(t, path, "v2")
+	for name, want := range map[string]string{
+		path:            "v2",
+		path + ".bak":   "v1",
+		path + ".bak.1": "v0",
+	} {
+		if got := readString(t, name); got != want {
+			t.Errorf("%s = %q, want %q", filepath.Base(name), got, want)
+		}
+	}
+	assertMissing(t, path+".bak.tmp")
+}
+
+// copyFile copies src into dir and returns the new path.
+func copyFile(t *testing.T, src, dir string) string {
+	t.Helper()
+	data, err := os.ReadFile(src)
+	if err != nil {
+		t.Fatal(err)
+	}
+	dst := filepath.Join(dir, filepath.Base(src))
+	if err := os.WriteFile(dst, data, 0644); err != nil {
+		t.Fatal(err)
+	}
+	return dst
+}
+
+// loadLegacy loads path, which must be a schema 0 file, and checks it comes
+// back at the current schema.
+func loadLegacy(t *testing.T, path string) *PARAMETERS {
+	t.Helper()
+	if strings.Contains(readString(t, path), "SCHEMA") {
+		t.Fatalf("%s is not a legacy file", path)
+	}
+	parameters, err := LoadParameters(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if parameters.SCHEMA != models.SchemaVersion {
+		t.Errorf("SCHEMA = %d after loading, want %d", parameters.SCHEMA, models.SchemaVersion)
+	}
+	return parameters
+}
+
+func TestLegacyConfigRoundTrip(t *testing.T) {
+	t.Setenv(PortEnv, "")
+	t.Setenv(BaudEnv, "")
+	path := copyFile(t, filepath.Join("..", "test.json"), t.TempDir())
+	parameters := loadLegacy(t, path)
+	if parameters.WEIGHT != 500 || len(parameters.BARS) != 2 {
+		t.Errorf("WEIGHT %g with %d bars, want 500 with 2", parameters.WEIGHT, len(parameters.BARS))
+	}
+
+	PersistParameters(path, parameters)
+	if !strings.Contains(readString(t, path), `"SCHEMA": 1`) {
+		t.Errorf("persisted file does not record the schema:\n%s", readString(t, path))
+	}
+	again, err := LoadParameters(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(again, parameters) {
+		t.Errorf("reloaded %+v, want %+v", again, parameters)
+	}
+}
+
+func TestLegacyCalibratedRoundTrip(t *testing.T) {
+	t.Setenv(PortEnv, "")
+	t.Setenv(BaudEnv, "")
+	dir := t.TempDir()
+	orig := filepath.Join("..", "test_calibrated.json")
+	// a zero that went negative was written wrapped around
+	wrapped := filepath.Join(dir, "wrapped.json")
+	if err := os.WriteFile(wrapped, []byte(strings.Replace(readString(t, orig), "148672864", "18446744073709551613", 1)), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for src, wantZero := range map[string]float64{orig: 148672864, wrapped: -3} {
+		parameters := loadLegacy(t, src)
+		if zero := parameters.BARS[0].LC[0].ZERO; zero != wantZero {
+			t.Errorf("%s: bar 1 LC 1 ZERO = %g, want %g", src, zero, wantZero)
+		}
+		if zero := parameters.BARS[1].LC[1].ZERO; zero != 152402351 {
+			t.Errorf("%s: bar 2 LC 2 ZERO = %g, want 152402351", src, zero)
+		}
+
+		saved := filepath.Join(dir, "saved_calibrated.json")
+		if err := SaveToJSON(saved, parameters, "1.0", "1"); err != nil {
+			t.Fatal(err)
+		}
+		again, err := LoadParameters(saved)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if again.SCHEMA != models.SchemaVersion || !reflect.DeepEqual(again.BARS, parameters.BARS) {
+			t.Errorf("%s: reloaded schema %d bars %+v, want %d and %+v", src, again.SCHEMA, again.BARS, models.SchemaVersion, parameters.BARS)
+		}
+	}
+}
+
+func TestNewerSchemaRefused(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "new.json")
+	if err := os.WriteFile(path, []byte(`{"SCHEMA": 99, "WEIGHT": 500}`), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := LoadParameters(path); err == nil || !strings.Contains(err.Error(), "update the tool") {
+		t.Errorf("err = %v, want a request to update the tool", err)
+	}
+}
@@ -0,0 +1,347 @@
+package file
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"reflect"
+	"strings"
+)
+
+// patchJSON returns original, a JSON document holding a value of type t,
+// with the values that differ from updated (the encoding of the new value)
+// written over it. Everything else (keys t does not know, unchanged values,
+// key order, whitespace and the spelling of numbers) is kept byte for byte.
+// Objects are patched key by key and arrays element by element while their
+// length is unchanged; other changed values are replaced whole, indented like
+// the surrounding lines. Keys set only in updated are appended to their
+// object, and known keys updated leaves out are removed unless they were
+// already empty.
+func patchJSON(original, updated []byte, t reflect.Type) ([]byte, error) {
+	start := len(original) - len(bytes.TrimLeft(original, " \t\r\n"))
+	end := len(bytes.TrimRight(original, " \t\r\n"))
+	if start == end {
+		return nil, errors.New("empty document")
+	}
+	if !json.Valid(original) {
+		return nil, errors.New("not valid JSON")
+	}
+	patched, err := patchValue(original[start:end], bytes.TrimSpace(updated), t, "", "  ")
+	if err != nil {
+		return nil, err
+	}
+	out := append([]byte(nil), original[:start]...)
+	out = append(out, patched...)
+	return append(out, original[end:]...), nil
+}
+
+// patchValue patches orig, the value of type t, to updated. prefix is the
+// indentation of the line holding the value and unit one indentation step.
+func patchValue(orig, updated []byte, t reflect.Type, prefix, unit string) ([]byte, error) {
+	if sameValue(orig, updated, t) {
+		return orig, nil
+	}
+	et := t
+	for et.Kind() == reflect.Ptr {
+		et = et.Elem()
+	}
+	switch {
+	case et.Kind() == reflect.Struct && isJSON(orig, '{') && isJSON(updated, '{'):
+		return patchObject(orig, updated, et, prefix, unit)
+	case et.Kind() == reflect.Slice && isJSON(orig, '[') && isJSON(updated, '['):
+		if patched, ok, err := patchArray(orig, updated, et, prefix, unit); ok || err != nil {
+			return patched, err
+		}
+	}
+	return formatValue(updated, prefix, unit), nil
+}
+
+// edit replaces orig[start:end] with text.
+type edit struct {
+	start, end int
+	text       []byte
+}
+
+func applyEdits(orig []byte, edits []edit) []byte {
+	out := make([]byte, 0, len(orig))
+	at := 0
+	for _, e := range edits {
+		out = append(out, orig[at:e.start]...)
+		out = append(out, e.text...)
+		at = e.end
+	}
+	return append(out, orig[at:]...)
+}
+
+func patchObject(orig, updated []byte, t reflect.Type, prefix, unit string) ([]byte, error) {
+	om, err := objectMembers(orig)
+	if err != nil {
+		return nil, err
+	}
+	um, err := objectMembers(updated)
+	if err != nil {
+		return nil, err
+	}
+	newVals := make(map[string][]byte, len(um))
+	for _, m := range um {
+		newVals[m.key] = updated[m.valStart:m.valEnd]
+	}
+	fields := jsonFields(t)
+	var edits []edit
+	present := make(map[string]bool, len(om))
+	kept := 0
+	for i, m := range om {
+		present[m.key] = true
+		ft, known := fields[m.key]
+		val, ok := newVals[m.key]
+		old := orig[m.valStart:m.valEnd]
+		if known && !ok && !isZero(old, ft) {
+			// drop the member with the separator before it, or after it
+			// when no member is left in front
+			switch {
+			case kept > 0:
+				edits = append(edits, edit{om[i-1].valEnd, m.valEnd, nil})
+			case i+1 < len(om):
+				edits = append(edits, edit{m.keyStart, om[i+1].keyStart, nil})
+			default:
+				edits = append(edits, edit{m.keyStart, m.valEnd, nil})
+			}
+			continue
+		}
+		kept++
+		if !known || !ok {
+			continue
+		}
+		line := lineIndent(orig, m.keyStart)
+		patched, err := patchValue(old, val, ft, line, stepFrom(line, prefix, unit))
+		if err != nil {
+			return nil, err
+		}
+		if !bytes.Equal(patched, old) {
+			edits = append(edits, edit{m.valStart, m.valEnd, patched})
+		}
+	}
+
+	// new keys go after the last member, laid out like it
+	var added []byte
+	sep, colon, line := "", ":", ""
+	if n := len(om); n > 0 {
+		last := om[n-1]
+		sep = string(leadingSpace(orig, last.keyStart))
+		colon = string(orig[last.keyEnd:last.valStart])
+		line = lineIndent(orig, last.keyStart)
+	}
+	for _, m := range um {
+		ft, known := fields[m.key]
+		val := newVals[m.key]
+		if present[m.key] || !known || isZero(val, ft) {
+			continue
+		}
+		if kept > 0 || len(added) > 0 {
+			added = append(added, ',')
+		}
+		key, _ := json.Marshal(m.key)
+		added = append(added, sep...)
+		added = append(added, key...)
+		added = append(added, colon...)
+		added = append(added, formatValue(val, line, stepFrom(line, prefix, unit))...)
+	}
+	if len(added) > 0 {
+		at := 1 // just inside an empty object
+		if n := len(om); n > 0 {
+			at = om[n-1].valEnd
+		}
+		edits = append(edits, edit{at, at, added})
+	}
+	return applyEdits(orig, edits), nil
+}
+
+// patchArray patches orig element by element. ok is false when the length
+// changed, leaving the caller to replace the array whole.
+func patchArray(orig, updated []byte, t reflect.Type, prefix, unit string) (patched []byte, ok bool, err error) {
+	oe, err := arrayElements(orig)
+	if err != nil {
+		return nil, false, err
+	}
+	ue, err := arrayElements(updated)
+	if err != nil {
+		return nil, false, err
+	}
+	if len(oe) != len(ue) {
+		return nil, false, nil
+	}
+	var edits []edit
+	for i, e := range oe {
+		old := orig[e.valStart:e.valEnd]
+		line := lineIndent(orig, e.valStart)
+		p, err := patchValue(old, updated[ue[i].valStart:ue[i].valEnd], t.Elem(), line, stepFrom(line, prefix, unit))
+		if err != nil {
+			return nil, false, err
+		}
+		if !bytes.Equal(p, old) {
+			edits = append(edits, edit{e.valStart, e.valEnd, p})
+		}
+	}
+	return applyEdits(orig, edits), true, nil
+}
+
+// member locates one object member (or array element, without a key) in
+// its enclosing value.
+type member struct {
+	key              string
+	keyStart, keyEnd int
+	valStart, valEnd int
+}
+
+// objectMembers returns the members of the JSON object data in order.
+func objectMembers(data []byte) ([]member, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+	var members []member
+	for dec.More() {
+		tok, err := dec.Token()
+		if err != nil {
+			return nil, err
+		}
+		keyEnd := int(dec.InputOffset())
+		var val json.RawMessage
+		if err := dec.Decode(&val); err != nil {
+			return nil, err
+		}
+		end := int(dec.InputOffset())
+		key, _ := tok.(string)
+		members = append(members, member{key: key, keyStart: quoteStart(data, keyEnd), keyEnd: keyEnd, valStart: end - len(val), valEnd: end})
+	}
+	return members, nil
+}
+
+// arrayElements returns the elements of the JSON array data in order.
+func arrayElements(data []byte) ([]member, error) {
+	dec := json.NewDecoder(bytes.NewReader(data))
+	if _, err := dec.Token(); err != nil {
+		return nil, err
+	}
+	var elements []member
+	for dec.More() {
+		var val json.RawMessage
+		if err := dec.Decode(&val); err != nil {
+			return nil, err
+		}
+		end := int(dec.InputOffset())
+		elements = append(elements, member{valStart: end - len(val), valEnd: end})
+	}
+	return elements, nil
+}
+
+// quoteStart returns the index of the quote opening the string that ends
+// just before end.
+func quoteStart(data []byte, end int) int {
+	for i := end - 2; i > 0; i-- {
+		if data[i] != '"' {
+			continue
+		}
+		escapes := 0
+		for j := i - 1; j >= 0 && data[j] == '\\'; j-- {
+			escapes++
+		}
+		if escapes%2 == 0 {
+			return i
+		}
+	}
+	return 0
+}
+
+// leadingSpace returns the whitespace in data right before pos.
+func leadingSpace(data []byte, pos int) []byte {
+	start := pos
+	for start > 0 && strings.IndexByte(" \t\r\n", data[start-1]) >= 0 {
+		start--
+	}
+	return data[start:pos]
+}
+
+// lineIndent returns the indentation of the line holding pos, or "" when
+// pos does not start its line.
+func lineIndent(data []byte, pos int) string {
+	space := leadingSpace(data, pos)
+	nl := bytes.LastIndexByte(space, '\n')
+	if nl < 0 {
+		return ""
+	}
+	return string(space[nl+1:])
+}
+
+// stepFrom returns the indentation step between a parent line indented by
+// prefix and a child line indented by line, or unit when they do not nest.
+func stepFrom(line, prefix, unit string) string {
+	if step, ok := strings.CutPrefix(line, prefix); ok && step != "" {
+		return step
+	}
+	return unit
+}
+
+// formatValue returns val laid out to continue a line indented by prefix:
+// indented by unit per level, or compact when prefix is empty (a one-line
+// document or a value that does not start its own line).
+func formatValue(val []byte, prefix, unit string) []byte {
+	var buf bytes.Buffer
+	var err error
+	if prefix == "" {
+		err = json.Compact(&buf, val)
+	} else {
+		err = json.Indent(&buf, val, prefix, unit)
+	}
+	if err != nil {
+		return val
+	}
+	return buf.Bytes()
+}
+
+// sameValue reports whether a and b decode to equal values of type t.
+func sameValue(a, b []byte, t reflect.Type) bool {
+	va, vb := reflect.New(t), reflect.New(t)
+	if json.Unmarshal(a, va.Interface()) != nil || json.Unmarshal(b, vb.Interface()) != nil {
+		return false
+	}
+	return reflect.DeepEqual(va.Elem().Interface(), vb.Elem().Interface())
+}
+
+// isZero reports whether data decodes to the zero value of t, as omitempty
+// leaves it out.
+func isZero(data []byte, t reflect.Type) bool {
+	v := reflect.New(t)
+	if json.Unmarshal(data, v.Interface()) != nil {
+		return false
+	}
+	return v.Elem().IsZero() || (v.Elem().Kind() == reflect.Slice && v.Elem().Len() == 0)
+}
+
+// isJSON reports whether data is a JSON value starting with open.
+func isJSON(data []byte, open byte) bool {
+	return len(data) > 0 && data[0] == open
+}
+
+// jsonFields maps the JSON key of each exported field of struct type t to
+// the field's type.
+func jsonFields(t reflect.Type) map[string]reflect.Type {
+	fields := make(map[string]reflect.Type)
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		if !f.IsExported() {
+			continue
+		}
+		name := f.Name
+		if tag, ok := f.Tag.Lookup("json"); ok {
+			if tag == "-" {
+				continue
+			}
+			if n, _, _ := strings.Cut(tag, ","); n != "" {
+				name = n
+			}
+		}
+		fields[name] = f.Type
+	}
+	return fields
+}
@@ -0,0 +1,146 @@
+package file
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// customConfig is a hand-edited config: tab indentation, one-line objects,
+// a float spelling of WEIGHT and keys the tool does not know at the top level
+// and inside a bar.
+const customConfig = `{
+	"SITE_NOTES": "dock 3, left shelf",
+	"SERIAL": {"PORT": "COM3", "BAUDRATE": 115200, "COMMAND": "M"},
+	"WEIGHT": 500.0,
+	"AVG":    10,
+	"DEBUG": false,
+	"BARS": [
+		{"ID": 1, "LCS": 15, "INSTALLER": {"TAG": "A-17"}},
+		{"ID": 2, "LCS": 3}
+	]
+}
+`
+
+func TestPersistParametersKeepsFormatting(t *testing.T) {
+	t.Setenv(PortEnv, "")
+	t.Setenv(BaudEnv, "")
+	path := filepath.Join(t.TempDir(), "config.json")
+	if err := os.WriteFile(path, []byte(customConfig), 0644); err != nil {
+		t.Fatal(err)
+	}
+	parameters, err := LoadParameters(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// persisting unchanged parameters only records the schema
+	PersistParameters(path, parameters)
+	withSchema := strings.Replace(customConfig, "\n\t]\n}", "\n\t],\n\t\"SCHEMA\": 1\n}", 1)
+	if got := readString(t, path); got != withSchema {
+		t.Errorf("unchanged persist wrote\n%s\nwant\n%s", got, withSchema)
+	}
+
+	parameters.SERIAL.PORT = "COM7"
+	PersistParameters(path, parameters)
+	want := strings.Replace(withSchema, `"COM3"`, `"COM7"`, 1)
+	if got := readString(t, path); got != want {
+		t.Errorf("persist wrote\n%s\nwant\n%s", got, want)
+	}
+}
+
+type patchDoc struct {
+	NAME  string      `json:"NAME,omitempty"`
+	COUNT int         `json:"COUNT"`
+	ITEMS []patchItem `json:"ITEMS,omitempty"`
+}
+
+type patchItem struct {
+	V float64 `json:"V"`
+}
+
+func TestPatchJSON(t *testing.T) {
+	for _, tc := range []struct {
+		name     string
+		original string
+		updated  patchDoc
+		want     string
+	}{
+		{
+			"unchanged keeps spelling",
+			"{\"COUNT\": 1, \"NAME\":\"a\" , \"X\": [1,2], \"ITEMS\":[{\"V\": 2.50e0}]}",
+			patchDoc{NAME: "a", COUNT: 1, ITEMS: []patchItem{{2.5}}},
+			"{\"COUNT\": 1, \"NAME\":\"a\" , \"X\": [1,2], \"ITEMS\":[{\"V\": 2.50e0}]}",
+		},
+		{
+			"changed scalar",
+			"{\n  \"NAME\": \"a\",\n  \"COUNT\": 1\n}",
+			patchDoc{NAME: "a", COUNT: 2},
+			"{\n  \"NAME\": \"a\",\n  \"COUNT\": 2\n}",
+		},
+		{
+			"removed first key",
+			"{\n  \"NAME\": \"a\",\n  \"COUNT\": 1\n}",
+			patchDoc{COUNT: 1},
+			"{\n  \"COUNT\": 1\n}",
+		},
+		{
+			"removed last key",
+			"{\"X\": 0, \"COUNT\": 1, \"NAME\": \"a\"}",
+			patchDoc{COUNT: 1},
+			"{\"X\": 0, \"COUNT\": 1}",
+		},
+		{
+			"added to compact object",
+			"{\"COUNT\":1}",
+			patchDoc{NAME: "b", COUNT: 1},
+			"{\"COUNT\":1,\"NAME\":\"b\"}",
+		},
+		{
+			"added to empty object",
+			"{}",
+			patchDoc{COUNT: 3},
+			"{\"COUNT\":3}",
+		},
+		{
+			"element keeps unknown key",
+			"{\n    \"COUNT\": 1,\n    \"ITEMS\": [\n        {\"V\": 1, \"NOTE\": \"x\"},\n        {\"V\": 2}\n    ]\n}",
+			patchDoc{COUNT: 1, ITEMS: []patchItem{{1}, {2.5}}},
+			"{\n    \"COUNT\": 1,\n    \"ITEMS\": [\n        {\"V\": 1, \"NOTE\": \"x\"},\n        {\"V\": 2.5}\n    ]\n}",
+		},
+		{
+			"grown array indented like its line",
+			"{\n    \"ITEMS\": [{\"V\": 1}],\n    \"COUNT\": 1\n}",
+			patchDoc{COUNT: 1, ITEMS: []patchItem{{1}, {2}}},
+			"{\n    \"ITEMS\": [\n        {\n            \"V\": 1\n        },\n        {\n            \"V\": 2\n        }\n    ],\n    \"COUNT\": 1\n}",
+		},
+	} {
+		updated, err := json.Marshal(tc.updated)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got, err := patchJSON([]byte(tc.original), updated, reflect.TypeOf(tc.updated))
+		if err != nil {
+			t.Errorf("%s: %v", tc.name, err)
+			continue
+		}
+		if string(got) != tc.want {
+			t.Errorf("%s: got\n%s\nwant\n%s", tc.name, got, tc.want)
+		}
+		var back patchDoc
+		if err := json.Unmarshal(got, &back); err != nil || !reflect.DeepEqual(back, tc.updated) {
+			t.Errorf("%s: patched document reads back as %+v (%v)", tc.name, back, err)
+		}
+	}
+}
+
+func TestPatchJSONInvalid(t *testing.T) {
+	for _, original := range []string{"", "  ", "{\"COUNT\": 1", "{} {}"} {
+		if _, err := patchJSON([]byte(original), []byte(`{"COUNT":1}`), reflect.TypeOf(patchDoc{})); err == nil {
+			t.Errorf("%q patched", original)
+		}
+	}
+}
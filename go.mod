@@ -3,9 +3,12 @@ module github.com/CK6170/Calrunrilla-go
 go 1.25.0
 
 require (
-	github.com/eiannone/keyboard v0.0.0-20220611211555-0d226195f203 // indirect
-	github.com/tarm/serial v0.0.0-20180830185346-98f6abe2eb07 // indirect
+	github.com/eiannone/keyboard v0.0.0-20220611211555-0d226195f203
+	github.com/tarm/serial v0.0.0-20180830185346-98f6abe2eb07
+	gonum.org/v1/gonum v0.16.0
+)
+
+require (
 	golang.org/x/sys v0.38.0 // indirect
 	golang.org/x/term v0.37.0 // indirect
-	gonum.org/v1/gonum v0.16.0 // indirect
 )
@@ -9,6 +9,7 @@ import (
 	"strings"
 
 	calibration "github.com/CK6170/Calrunrilla-go/calibration"
+	file "github.com/CK6170/Calrunrilla-go/file"
 	matrix "github.com/CK6170/Calrunrilla-go/matrix"
 	models "github.com/CK6170/Calrunrilla-go/models"
 	serialpkg "github.com/CK6170/Calrunrilla-go/serial"
@@ -48,7 +49,7 @@ type Vector = matrix.Vector
 type Leo485 = serialpkg.Leo485
 
 var (
-	calibmsg       = "\nPut %d on the %s Bay on the %s side in the %s of the Shelf and Press 'C' to continue. Or <ESC> to exit."
+	calibmsg       = "\nPut %s on the %s Bay on the %s side in the %s of the Shelf and Press 'C' to continue. Or <ESC> to exit."
 	zeromsg        = "\nClear the Bay(s) and Press 'C' to continue. Or <ESC> to exit."
 	lastParameters *PARAMETERS // store parsed parameters for dynamic targets
 	immediateRetry bool
@@ -76,27 +77,51 @@ func main() {
 	// Support a simple version flag for CI and quick checks. If any argument is
 	// `-v` or `--version` print a plain-text version and exit before any other
 	// output so it is always visible and never treated as a config filename.
-	for _, a := range os.Args[1:] {
+	// -port/-baud take a value; they override SERIAL for this run only
+	valueFlags := map[string]string{"-port": file.PortEnv, "--port": file.PortEnv, "-baud": file.BaudEnv, "--baud": file.BaudEnv}
+	skip := make(map[int]bool) // argument indexes holding flag values
+	mode := ""                 // headless run mode selected by a flag, "" for calibration
+	var opts calibration.Options
+	for i, a := range os.Args[1:] {
+		if name, value, ok := strings.Cut(a, "="); ok && valueFlags[name] != "" {
+			os.Setenv(valueFlags[name], value)
+			continue
+		}
+		if env := valueFlags[a]; env != "" {
+			if i+2 >= len(os.Args) {
+				log.Fatalf("%s needs a value", a)
+			}
+			os.Setenv(env, os.Args[i+2])
+			skip[i+1] = true
+			continue
+		}
 		if a == "--version" || a == "-v" {
 			fmt.Printf("%s\n", strings.TrimSpace(fmt.Sprintf("%s [build %s]", AppVersion, AppBuild)))
 			return
 		}
-		// headless test and flash flags
-		if a == "--test" || a == "-t" {
-			// Expect the next non-flag argument to be the config path; leave parsing to below
-			// mark a special env var so we run test mode after resolving config
-			os.Setenv("CALRUNRILLA_RUN_TEST", "1")
-		}
-		if a == "--flash" || a == "-f" {
-			os.Setenv("CALRUNRILLA_RUN_FLASH", "1")
+		// headless test and flash flags; the config path is resolved below
+		switch a {
+		case "--test", "-t":
+			mode = "test"
+		case "--flash", "-f":
+			mode = "flash"
+		case "--corner", "-c":
+			mode = "corner"
+		case "--repeat", "-r":
+			mode = "repeat"
+		case "--adc", "-a":
+			mode = "adc"
+		case "--backup", "-b":
+			// opt-in: archive the calibration currently on the bars before flashing
+			opts.Backup = true
 		}
 	}
 
 	// Find the first non-flag argument and treat it as the config path. This
 	// prevents flags (like --version) from being interpreted as a filename.
 	configPath := ""
-	for _, a := range os.Args[1:] {
-		if strings.HasPrefix(a, "-") {
+	for i, a := range os.Args[1:] {
+		if strings.HasPrefix(a, "-") || skip[i] {
 			continue
 		}
 		configPath = a
@@ -107,12 +132,21 @@ func main() {
 	}
 
 	// If headless test/flash flags were set, run the corresponding flows and exit
-	if os.Getenv("CALRUNRILLA_RUN_TEST") == "1" {
+	switch mode {
+	case "test":
 		calibration.TestWeightsConfig(configPath)
 		return
-	}
-	if os.Getenv("CALRUNRILLA_RUN_FLASH") == "1" {
-		calibration.FlashOnly(configPath)
+	case "corner":
+		calibration.CornerTestConfig(configPath)
+		return
+	case "repeat":
+		calibration.RepeatabilityTestConfig(configPath)
+		return
+	case "adc":
+		calibration.RawADCConfig(configPath)
+		return
+	case "flash":
+		calibration.FlashOnly(configPath, AppVersion, AppBuild, opts)
 		return
 	}
 	// Route the standard logger output through our package-scope redWriter
@@ -131,7 +165,7 @@ func main() {
 		ui.Greenf("--------------------------------------------\n")
 		barsPerRow := calcBarsPerRow(getTerminalWidth())
 
-		calibration.CalRunrilla(configPath, barsPerRow, AppVersion, AppBuild)
+		calibration.CalRunrilla(configPath, barsPerRow, AppVersion, AppBuild, opts)
 		if immediateRetry {
 			// reset and immediately restart loop
 			immediateRetry = false
@@ -174,7 +208,7 @@ func main() {
 				if !calibration.ProbeVersion(bars, &params) {
 					ui.Warningf("ProbeVersion failed on %s\n", params.SERIAL.PORT)
 				} else {
-					calibration.TestWeights(bars, &params)
+					calibration.TestWeights(bars, &params, configPath)
 				}
 			}()
 			continue
@@ -0,0 +1,87 @@
+package matrix
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"strings"
+)
+
+// csvRow formats values as one comma-separated line.
+func csvRow(values []float64) string {
+	cols := make([]string, len(values))
+	for i, v := range values {
+		cols[i] = strconv.FormatFloat(v, 'g', -1, 64)
+	}
+	return strings.Join(cols, ",")
+}
+
+// ToCSV writes one comma-separated line per row.
+func (m *Matrix) ToCSV(w io.Writer) error {
+	for _, row := range m.Values {
+		if _, err := io.WriteString(w, csvRow(row)+"\n"); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// MarshalJSON encodes the matrix as an array of rows.
+func (m *Matrix) MarshalJSON() ([]byte, error) {
+	return json.Marshal(m.Values)
+}
+
+// FormatTable formats the matrix with prec decimals, one labelled row per
+// line and the columns right-aligned to the widest value.
+func (m *Matrix) FormatTable(prec int) string {
+	width := 0
+	for _, row := range m.Values {
+		width = max(width, cellWidth(row, prec))
+	}
+	sb := &strings.Builder{}
+	for i, row := range m.Values {
+		fmt.Fprintf(sb, "[%03d]", i)
+		for _, v := range row {
+			fmt.Fprintf(sb, " %*.*f", width, prec, v)
+		}
+		sb.WriteString("\n")
+	}
+	return sb.String()
+}
+
+// ToCSV writes the vector as a single comma-separated line.
+func (v *Vector) ToCSV(w io.Writer) error {
+	_, err := io.WriteString(w, csvRow(v.Values)+"\n")
+	return err
+}
+
+// MarshalJSON encodes the vector as an array.
+func (v *Vector) MarshalJSON() ([]byte, error) {
+	return json.Marshal(v.Values)
+}
+
+// FormatTable formats the vector with prec decimals, one labelled value per
+// line.
+func (v *Vector) FormatTable(prec int) string {
+	width := cellWidth(v.Values, prec)
+	sb := &strings.Builder{}
+	for i, val := range v.Values {
+		fmt.Fprintf(sb, "[%03d] %*.*f\n", i, width, prec, val)
+	}
+	return sb.String()
+}
+
+// cellWidth returns the width of the widest of values printed with prec
+// decimals, and at least 10 so small tables keep the usual layout.
+func cellWidth(values []float64, prec int) int {
+	width := 10
+	for _, v := range values {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			continue
+		}
+		width = max(width, len(strconv.FormatFloat(v, 'f', prec, 64)))
+	}
+	return width
+}
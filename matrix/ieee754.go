@@ -3,12 +3,37 @@ package matrix
 import (
 	"fmt"
 	"math"
+	"strconv"
+	"strings"
 )
 
 func ToIEEE754(f float32) uint32 {
 	return math.Float32bits(f)
 }
 
+// FromIEEE754 is the inverse of ToIEEE754.
+func FromIEEE754(bits uint32) float32 {
+	return math.Float32frombits(bits)
+}
+
+// FormatIEEEHex formats f as the 8 digit upper-case hex used in the LC IEEE field.
+func FormatIEEEHex(f float32) string {
+	return fmt.Sprintf("%08X", ToIEEE754(f))
+}
+
+// ParseIEEEHex parses an LC IEEE field (8 hex digits, optional 0x prefix).
+func ParseIEEEHex(s string) (float32, error) {
+	s = strings.TrimPrefix(strings.TrimPrefix(strings.TrimSpace(s), "0x"), "0X")
+	if len(s) != 8 {
+		return 0, fmt.Errorf("IEEE value %q is not 8 hex digits", s)
+	}
+	bits, err := strconv.ParseUint(s, 16, 32)
+	if err != nil {
+		return 0, fmt.Errorf("IEEE value %q: %v", s, err)
+	}
+	return FromIEEE754(uint32(bits)), nil
+}
+
 // printFactorsIEEE prints the factors as IEEE754 hex with decimal values, matching requested formatting
 func PrintFactorsIEEE(factors *Vector) {
 	// Orange color for factors
@@ -16,7 +41,7 @@ func PrintFactorsIEEE(factors *Vector) {
 	fmt.Println(MatrixLine)
 	fmt.Println("factors (IEEE754)")
 	for i, val := range factors.Values {
-		hex := fmt.Sprintf("%08X", ToIEEE754(float32(val)))
+		hex := FormatIEEEHex(float32(val))
 		// Use space flag to align sign: positive numbers get a leading space, negatives show '-'
 		// This keeps the decimal column aligned regardless of sign.
 		fmt.Printf("[%03d]  % .12f  %s\n", i, val, hex)
@@ -16,10 +16,13 @@ type Matrix struct {
 	Values     [][]float64
 }
 
+// NewMatrix returns a zero rows x cols matrix. The rows share one backing
+// array, so a matrix costs two allocations whatever its size.
 func NewMatrix(rows, cols int) *Matrix {
 	values := make([][]float64, rows)
+	backing := make([]float64, rows*cols)
 	for i := range values {
-		values[i] = make([]float64, cols)
+		values[i] = backing[i*cols : (i+1)*cols : (i+1)*cols]
 	}
 	return &Matrix{Rows: rows, Cols: cols, Values: values}
 }
@@ -35,29 +38,87 @@ func (m *Matrix) Norm() float64 {
 }
 
 func (m *Matrix) Sub(other *Matrix) *Matrix {
-	result := NewMatrix(m.Rows, m.Cols)
+	return m.SubInto(NewMatrix(m.Rows, m.Cols), other)
+}
+
+// SubInto stores m - other in dst and returns it. dst must have the shape of
+// m and may be m itself.
+func (m *Matrix) SubInto(dst, other *Matrix) *Matrix {
 	for i := range m.Values {
 		for j := range m.Values[i] {
-			result.Values[i][j] = m.Values[i][j] - other.Values[i][j]
+			dst.Values[i][j] = m.Values[i][j] - other.Values[i][j]
 		}
 	}
-	return result
+	return dst
 }
 
 func (m *Matrix) MulVector(v *Vector) *Vector {
 	if m.Cols != v.Length {
 		return nil
 	}
-	result := NewVector(m.Rows)
+	return m.MulVectorInto(NewVector(m.Rows), v)
+}
+
+// MulVectorInto stores m * v in dst (of length m.Rows, not v) and returns it,
+// or nil when the dimensions do not match.
+func (m *Matrix) MulVectorInto(dst, v *Vector) *Vector {
+	if m.Cols != v.Length || dst.Length != m.Rows || dst == v {
+		return nil
+	}
 	for i := 0; i < m.Rows; i++ {
+		sum := 0.0
 		for k := 0; k < m.Cols; k++ {
-			result.Values[i] += m.Values[i][k] * v.Values[k]
+			sum += m.Values[i][k] * v.Values[k]
 		}
+		dst.Values[i] = sum
 	}
-	return result
+	return dst
 }
 
+// SVDInfo describes the singular value decomposition behind PseudoInverse.
+type SVDInfo struct {
+	Values    []float64 // singular values, largest first
+	Rank      int       // number of singular values above the cut-off
+	Condition float64   // largest / smallest singular value; +Inf when rank deficient
+}
+
+// InverseSVD returns the pseudoinverse of m, or nil when it cannot be computed.
+//
+// Deprecated: use PseudoInverse, which reports why it failed and how well
+// conditioned m is.
 func (m *Matrix) InverseSVD() *Matrix {
+	pinv, _, err := m.PseudoInverse()
+	if err != nil {
+		return nil
+	}
+	return pinv
+}
+
+// PseudoInverse returns the Moore-Penrose pseudoinverse of m computed by SVD,
+// with the singular values, rank and condition number of m. Singular values
+// below a relative cut-off are treated as zero, so a rank deficient m still
+// yields the minimum norm pseudoinverse (with Condition +Inf). An error is
+// returned for an empty or all-zero m or when the SVD does not converge.
+func (m *Matrix) PseudoInverse() (*Matrix, SVDInfo, error) {
+	return m.pseudoInverse(0)
+}
+
+// PseudoInverseRidge is PseudoInverse with Tikhonov damping: each singular
+// value s is inverted as s/(s^2+lambda^2) instead of 1/s, which limits the
+// influence of the small singular values of a nearly collinear m. lambda is
+// in the units of the singular values; 0 gives PseudoInverse.
+func (m *Matrix) PseudoInverseRidge(lambda float64) (*Matrix, SVDInfo, error) {
+	if lambda < 0 || math.IsNaN(lambda) {
+		return nil, SVDInfo{}, fmt.Errorf("ridge parameter must be >= 0, got %g", lambda)
+	}
+	return m.pseudoInverse(lambda)
+}
+
+func (m *Matrix) pseudoInverse(lambda float64) (*Matrix, SVDInfo, error) {
+	var info SVDInfo
+	if m.Rows == 0 || m.Cols == 0 {
+		return nil, info, fmt.Errorf("pseudoinverse of an empty %dx%d matrix", m.Rows, m.Cols)
+	}
 	a := mat.NewDense(m.Rows, m.Cols, nil)
 	for i := 0; i < m.Rows; i++ {
 		for j := 0; j < m.Cols; j++ {
@@ -68,7 +129,7 @@ func (m *Matrix) InverseSVD() *Matrix {
 	var svd mat.SVD
 	ok := svd.Factorize(a, mat.SVDThin)
 	if !ok {
-		return nil
+		return nil, info, fmt.Errorf("SVD of the %dx%d matrix did not converge", m.Rows, m.Cols)
 	}
 	var u, v mat.Dense
 	svd.UTo(&u)
@@ -83,13 +144,24 @@ func (m *Matrix) InverseSVD() *Matrix {
 	}
 	eps := 1e-12 * math.Max(float64(m.Rows), float64(m.Cols)) * maxS
 
+	info.Values = s
 	sp := mat.NewDense(len(s), len(s), nil)
+	minS := math.Inf(1)
 	for i := range s {
 		if s[i] > eps {
-			sp.Set(i, i, 1.0/s[i])
+			sp.Set(i, i, s[i]/(s[i]*s[i]+lambda*lambda))
+			info.Rank++
 		} else {
 			sp.Set(i, i, 0)
 		}
+		minS = math.Min(minS, s[i])
+	}
+	if info.Rank == 0 {
+		return nil, info, fmt.Errorf("pseudoinverse of an all-zero %dx%d matrix", m.Rows, m.Cols)
+	}
+	info.Condition = math.Inf(1)
+	if info.Rank == len(s) {
+		info.Condition = maxS / minS
 	}
 
 	var vSp mat.Dense
@@ -105,7 +177,45 @@ func (m *Matrix) InverseSVD() *Matrix {
 			pinv.Values[i][j] = pinvDense.At(i, j)
 		}
 	}
-	return pinv
+	return pinv, info, nil
+}
+
+// WeightRows scales row i of a and b by sqrt(w[i]), turning the weighted
+// least squares problem min sum_i w[i]*(a*x - b)[i]^2 into an ordinary one.
+// Weights must be non-negative; a weight of 1 leaves the row unchanged.
+func WeightRows(a *Matrix, b, w *Vector) (*Matrix, *Vector, error) {
+	if b.Length != a.Rows || w.Length != a.Rows {
+		return nil, nil, fmt.Errorf("weighted solve: %dx%d matrix with %d values and %d weights", a.Rows, a.Cols, b.Length, w.Length)
+	}
+	wa := NewMatrix(a.Rows, a.Cols)
+	wb := NewVector(b.Length)
+	for i := 0; i < a.Rows; i++ {
+		if w.Values[i] < 0 || math.IsNaN(w.Values[i]) {
+			return nil, nil, fmt.Errorf("weighted solve: weight %d is %g", i, w.Values[i])
+		}
+		s := math.Sqrt(w.Values[i])
+		for j := 0; j < a.Cols; j++ {
+			wa.Values[i][j] = s * a.Values[i][j]
+		}
+		wb.Values[i] = s * b.Values[i]
+	}
+	return wa, wb, nil
+}
+
+// SolveWeighted returns the x minimising sum_i w[i]*(a*x - b)[i]^2 (the
+// minimum norm one when a is rank deficient) and the SVD details of the
+// weighted matrix. With all weights 1 the result is exactly
+// a.PseudoInverse() * b.
+func SolveWeighted(a *Matrix, b, w *Vector) (*Vector, SVDInfo, error) {
+	wa, wb, err := WeightRows(a, b, w)
+	if err != nil {
+		return nil, SVDInfo{}, err
+	}
+	pinv, info, err := wa.PseudoInverse()
+	if err != nil {
+		return nil, info, err
+	}
+	return pinv.MulVector(wb), info, nil
 }
 
 func (m *Matrix) GetRow(i int) *Vector {
@@ -118,18 +228,48 @@ func (m *Matrix) SetRow(i int, v *Vector) {
 	copy(m.Values[i], v.Values)
 }
 
+// WithoutRows returns a copy of m without the rows listed in drop.
+func (m *Matrix) WithoutRows(drop []int) *Matrix {
+	skip := make(map[int]bool, len(drop))
+	for _, i := range drop {
+		skip[i] = true
+	}
+	kept := 0
+	for i := 0; i < m.Rows; i++ {
+		if !skip[i] {
+			kept++
+		}
+	}
+	result := NewMatrix(kept, m.Cols)
+	r := 0
+	for i := 0; i < m.Rows; i++ {
+		if !skip[i] {
+			copy(result.Values[r], m.Values[i])
+			r++
+		}
+	}
+	return result
+}
+
+// SetAllRows copies v into every row of m.
+func (m *Matrix) SetAllRows(v *Vector) {
+	for i := range m.Values {
+		copy(m.Values[i], v.Values)
+	}
+}
+
+// ToStrings returns the matrix as a titled table and as CSV lines (the title,
+// then one line per row) for the debug file.
 func (m *Matrix) ToStrings(title, format string) (string, string) {
 	sb := &strings.Builder{}
 	sb.WriteString(MatrixLine + "\n")
 	sb.WriteString(title + "\n")
-	for i := range m.Values {
-		for j := range m.Values[i] {
-			fmt.Fprintf(sb, "%10.0f", m.Values[i][j])
-		}
-		sb.WriteString("\n")
-	}
+	sb.WriteString(m.FormatTable(0))
 	sb.WriteString(MatrixLine)
-	return sb.String(), ""
+	csv := &strings.Builder{}
+	csv.WriteString(title + "\n")
+	_ = m.ToCSV(csv)
+	return sb.String(), strings.TrimSuffix(csv.String(), "\n")
 }
 
 // printMatrix dumps the full matrix (may be large). For debugging only.
@@ -140,25 +280,17 @@ func PrintMatrix(m *Matrix, title string, debug bool) {
 	}
 	fmt.Println(MatrixLine)
 	fmt.Println(title, " (", m.Rows, "x", m.Cols, ")")
-	maxRows := m.Rows
-	if maxRows > 12 { // limit output for readability
-		maxRows = 12
-	}
-	for i := 0; i < maxRows; i++ {
-		row := m.Values[i]
-		line := fmt.Sprintf("[%03d]", i)
-		maxCols := len(row)
-		if maxCols > 16 {
-			maxCols = 16
-		}
-		for j := 0; j < maxCols; j++ {
-			line += fmt.Sprintf(" %10.0f", row[j])
-		}
-		if len(row) > maxCols {
-			line += " ..."
-		}
-		fmt.Println(line)
+	// limit output for readability
+	maxRows, maxCols := min(m.Rows, 12), min(m.Cols, 16)
+	view := NewMatrix(maxRows, maxCols)
+	for i := range view.Values {
+		copy(view.Values[i], m.Values[i][:maxCols])
+	}
+	table := view.FormatTable(0)
+	if m.Cols > maxCols {
+		table = strings.ReplaceAll(table, "\n", " ...\n")
 	}
+	fmt.Print(table)
 	if m.Rows > maxRows {
 		fmt.Println("...")
 	}
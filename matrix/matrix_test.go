@@ -0,0 +1,382 @@
+package matrix
+
+import (
+	"math"
+	"math/rand"
+	"strings"
+	"testing"
+)
+
+// fromRows builds a matrix from literal rows.
+func fromRows(rows ...[]float64) *Matrix {
+	m := NewMatrix(len(rows), len(rows[0]))
+	for i, r := range rows {
+		copy(m.Values[i], r)
+	}
+	return m
+}
+
+func assertMatrix(t *testing.T, name string, got, want *Matrix, tol float64) {
+	t.Helper()
+	if got.Rows != want.Rows || got.Cols != want.Cols {
+		t.Fatalf("%s is %dx%d, want %dx%d", name, got.Rows, got.Cols, want.Rows, want.Cols)
+	}
+	for i := range want.Values {
+		for j, w := range want.Values[i] {
+			if math.Abs(got.Values[i][j]-w) > tol {
+				t.Errorf("%s[%d][%d] = %g, want %g", name, i, j, got.Values[i][j], w)
+			}
+		}
+	}
+}
+
+func TestPseudoInverseFullRank(t *testing.T) {
+	a := fromRows([]float64{3, 0}, []float64{0, 1}, []float64{0, 0})
+	pinv, info, err := a.PseudoInverse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertMatrix(t, "pinv", pinv, fromRows([]float64{1.0 / 3, 0, 0}, []float64{0, 1, 0}), 1e-12)
+	if info.Rank != 2 {
+		t.Errorf("rank = %d, want 2", info.Rank)
+	}
+	if math.Abs(info.Condition-3) > 1e-12 {
+		t.Errorf("condition = %g, want 3", info.Condition)
+	}
+	if len(info.Values) != 2 || math.Abs(info.Values[0]-3) > 1e-12 || math.Abs(info.Values[1]-1) > 1e-12 {
+		t.Errorf("singular values = %v, want [3 1]", info.Values)
+	}
+}
+
+func TestPseudoInverseRankDeficient(t *testing.T) {
+	// rank one: the pseudoinverse of u v^T is A^T / ||A||_F^2
+	a := fromRows([]float64{1, 2}, []float64{2, 4})
+	pinv, info, err := a.PseudoInverse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertMatrix(t, "pinv", pinv, fromRows([]float64{1.0 / 25, 2.0 / 25}, []float64{2.0 / 25, 4.0 / 25}), 1e-12)
+	if info.Rank != 1 {
+		t.Errorf("rank = %d, want 1", info.Rank)
+	}
+	if !math.IsInf(info.Condition, 1) {
+		t.Errorf("condition = %g, want +Inf", info.Condition)
+	}
+}
+
+func TestPseudoInverseErrors(t *testing.T) {
+	if _, _, err := NewMatrix(0, 3).PseudoInverse(); err == nil {
+		t.Error("empty matrix accepted")
+	}
+	if _, _, err := NewMatrix(3, 2).PseudoInverse(); err == nil {
+		t.Error("all-zero matrix accepted")
+	}
+	if pinv := NewMatrix(3, 2).InverseSVD(); pinv != nil {
+		t.Error("InverseSVD of an all-zero matrix is not nil")
+	}
+	if _, _, err := fromRows([]float64{1}).PseudoInverseRidge(-1); err == nil {
+		t.Error("negative ridge parameter accepted")
+	}
+}
+
+func TestPseudoInverseRidge(t *testing.T) {
+	a := fromRows([]float64{3, 0}, []float64{0, 1})
+	pinv, _, err := a.PseudoInverseRidge(1)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// s/(s^2+lambda^2) on the diagonal
+	assertMatrix(t, "ridge pinv", pinv, fromRows([]float64{0.3, 0}, []float64{0, 0.5}), 1e-12)
+}
+
+// randomMatrix fills a rows x cols matrix from rng.
+func randomMatrix(rng *rand.Rand, rows, cols int) *Matrix {
+	m := NewMatrix(rows, cols)
+	for i := range m.Values {
+		for j := range m.Values[i] {
+			m.Values[i][j] = rng.NormFloat64()
+		}
+	}
+	return m
+}
+
+func TestSolveWeightedUniform(t *testing.T) {
+	rng := rand.New(rand.NewSource(1))
+	a := randomMatrix(rng, 12, 6)
+	b := NewVector(12)
+	for i := range b.Values {
+		b.Values[i] = rng.NormFloat64()
+	}
+	x, _, err := SolveWeighted(a, b, NewVectorWithValue(12, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	pinv, _, err := a.PseudoInverse()
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := pinv.MulVector(b)
+	for i, v := range want.Values {
+		if x.Values[i] != v {
+			t.Errorf("x[%d] = %v with unit weights, want exactly %v", i, x.Values[i], v)
+		}
+	}
+}
+
+func TestSolveWeightedOutlier(t *testing.T) {
+	// y = 2x on every row but the last, which is far off
+	a := fromRows([]float64{1}, []float64{2}, []float64{3}, []float64{4})
+	b := &Vector{Length: 4, Values: []float64{2, 4, 6, 20}}
+	plain, _, err := SolveWeighted(a, b, NewVectorWithValue(4, 1))
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := &Vector{Length: 4, Values: []float64{1, 1, 1, 1e-8}}
+	x, _, err := SolveWeighted(a, b, w)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if math.Abs(x.Values[0]-2) > 1e-6 {
+		t.Errorf("weighted slope = %g, want 2", x.Values[0])
+	}
+	if math.Abs(plain.Values[0]-2) < 0.5 {
+		t.Errorf("unweighted slope = %g, expected the outlier to pull it away from 2", plain.Values[0])
+	}
+}
+
+func TestWeightRowsErrors(t *testing.T) {
+	a := fromRows([]float64{1, 0}, []float64{0, 1})
+	b := NewVectorWithValue(2, 1)
+	for name, w := range map[string]*Vector{
+		"short":    NewVectorWithValue(1, 1),
+		"negative": {Length: 2, Values: []float64{1, -1}},
+		"NaN":      {Length: 2, Values: []float64{math.NaN(), 1}},
+	} {
+		if _, _, err := WeightRows(a, b, w); err == nil {
+			t.Errorf("%s weights accepted", name)
+		}
+	}
+	if _, _, err := WeightRows(a, NewVector(3), NewVectorWithValue(2, 1)); err == nil {
+		t.Error("value count mismatch accepted")
+	}
+	wa, wb, err := WeightRows(a, b, &Vector{Length: 2, Values: []float64{4, 0}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assertMatrix(t, "weighted a", wa, fromRows([]float64{2, 0}, []float64{0, 0}), 0)
+	if wb.Values[0] != 2 || wb.Values[1] != 0 {
+		t.Errorf("weighted b = %v, want [2 0]", wb.Values)
+	}
+}
+
+func TestSubIntoAliasing(t *testing.T) {
+	rng := rand.New(rand.NewSource(3))
+	m, other := randomMatrix(rng, 4, 3), randomMatrix(rng, 4, 3)
+	want := m.Sub(other)
+	if got := m.SubInto(m, other); got != m {
+		t.Fatal("SubInto did not return dst")
+	}
+	assertMatrix(t, "m - other in place", m, want, 0)
+
+	v := &Vector{Length: 3, Values: []float64{5, 7, 9}}
+	o := &Vector{Length: 3, Values: []float64{1, 2, 3}}
+	if got := v.SubInto(v, o); got != v || v.Values[0] != 4 || v.Values[1] != 5 || v.Values[2] != 6 {
+		t.Errorf("vector SubInto in place = %v, want [4 5 6]", v.Values)
+	}
+}
+
+func TestMulVectorInto(t *testing.T) {
+	rng := rand.New(rand.NewSource(4))
+	m := randomMatrix(rng, 5, 3)
+	v := &Vector{Length: 3, Values: []float64{1, -2, 0.5}}
+	want := m.MulVector(v)
+	dst := NewVectorWithValue(5, 99)
+	if got := m.MulVectorInto(dst, v); got != dst {
+		t.Fatal("MulVectorInto did not return dst")
+	}
+	for i := range want.Values {
+		if dst.Values[i] != want.Values[i] {
+			t.Errorf("dst[%d] = %v, want %v", i, dst.Values[i], want.Values[i])
+		}
+	}
+	// v is read while dst is written, so they must differ
+	sq := randomMatrix(rng, 3, 3)
+	if sq.MulVectorInto(v, v) != nil {
+		t.Error("MulVectorInto accepted dst == v")
+	}
+	if m.MulVectorInto(NewVector(4), v) != nil || m.MulVector(NewVector(4)) != nil {
+		t.Error("dimension mismatch accepted")
+	}
+}
+
+// sink keeps matrices built under AllocsPerRun on the heap.
+var sink *Matrix
+
+func TestNewMatrix(t *testing.T) {
+	m := NewMatrix(3, 2)
+	// appending to a row must not spill into the next one
+	_ = append(m.Values[0], 1)
+	if m.Values[1][0] != 0 {
+		t.Error("rows share capacity")
+	}
+	// the row slices and their backing array, plus the Matrix itself
+	if n := testing.AllocsPerRun(100, func() { sink = NewMatrix(24, 12) }); n != 3 {
+		t.Errorf("NewMatrix allocates %v times, want 3", n)
+	}
+	if n := testing.AllocsPerRun(100, func() { m.SubInto(m, m) }); n != 0 {
+		t.Errorf("SubInto allocates %v times", n)
+	}
+}
+
+// TestResidualUnchanged pins the residual computed the way calcZerosFactors
+// does it, with one scratch vector, to the allocating form.
+func TestResidualUnchanged(t *testing.T) {
+	rng := rand.New(rand.NewSource(5))
+	add := randomMatrix(rng, 12, 6)
+	f := &Vector{Length: 6, Values: []float64{0.011, 0.012, 0.0105, 0.0098, 0.021, 0.019}}
+	w := NewVectorWithValue(12, 500)
+	want := add.MulVector(f).Sub(w).Norm()
+	resid := NewVector(12)
+	if got := add.MulVectorInto(resid, f).SubInto(resid, w).Norm(); got != want {
+		t.Errorf("residual norm = %v, want %v", got, want)
+	}
+}
+
+func BenchmarkSub(b *testing.B) {
+	rng := rand.New(rand.NewSource(1))
+	m, other := randomMatrix(rng, 24, 12), randomMatrix(rng, 24, 12)
+	b.ReportAllocs()
+	for b.Loop() {
+		m.Sub(other)
+	}
+}
+
+func BenchmarkSubInto(b *testing.B) {
+	rng := rand.New(rand.NewSource(1))
+	m, other := randomMatrix(rng, 24, 12), randomMatrix(rng, 24, 12)
+	dst := NewMatrix(24, 12)
+	b.ReportAllocs()
+	for b.Loop() {
+		m.SubInto(dst, other)
+	}
+}
+
+func BenchmarkMulVector(b *testing.B) {
+	rng := rand.New(rand.NewSource(1))
+	m := randomMatrix(rng, 24, 12)
+	v := NewVectorWithValue(12, 0.01)
+	b.ReportAllocs()
+	for b.Loop() {
+		m.MulVector(v)
+	}
+}
+
+func BenchmarkMulVectorInto(b *testing.B) {
+	rng := rand.New(rand.NewSource(1))
+	m := randomMatrix(rng, 24, 12)
+	v := NewVectorWithValue(12, 0.01)
+	dst := NewVector(24)
+	b.ReportAllocs()
+	for b.Loop() {
+		m.MulVectorInto(dst, v)
+	}
+}
+
+func TestWithoutRows(t *testing.T) {
+	m := fromRows([]float64{1, 1}, []float64{2, 2}, []float64{3, 3}, []float64{4, 4})
+	// duplicates and indexes past the end are ignored
+	got := m.WithoutRows([]int{3, 1, 1, 7})
+	assertMatrix(t, "kept rows", got, fromRows([]float64{1, 1}, []float64{3, 3}), 0)
+	got.Values[0][0] = 9
+	if m.Values[0][0] != 1 {
+		t.Error("WithoutRows shares rows with m")
+	}
+	if all := m.WithoutRows(nil); all.Rows != 4 {
+		t.Errorf("WithoutRows(nil) kept %d rows, want 4", all.Rows)
+	}
+
+	v := &Vector{Length: 4, Values: []float64{1, 2, 3, 4}}
+	w := v.Without([]int{0, 2, 9})
+	if w.Length != 2 || w.Values[0] != 2 || w.Values[1] != 4 {
+		t.Errorf("Without = %v (length %d), want [2 4]", w.Values, w.Length)
+	}
+}
+
+func TestSetAllRows(t *testing.T) {
+	m := NewMatrix(3, 2)
+	m.SetAllRows(&Vector{Length: 2, Values: []float64{5, 6}})
+	assertMatrix(t, "rows", m, fromRows([]float64{5, 6}, []float64{5, 6}, []float64{5, 6}), 0)
+}
+
+func TestToCSV(t *testing.T) {
+	nan, inf := math.NaN(), math.Inf(1)
+	cases := []struct {
+		name string
+		m    *Matrix
+		want string
+	}{
+		{"plain", fromRows([]float64{1, 2.5}, []float64{-3, 1e21}), "1,2.5\n-3,1e+21\n"},
+		{"nan and inf", fromRows([]float64{nan, inf, -inf}), "NaN,+Inf,-Inf\n"},
+		{"empty", NewMatrix(0, 0), ""},
+	}
+	for _, c := range cases {
+		sb := &strings.Builder{}
+		if err := c.m.ToCSV(sb); err != nil {
+			t.Fatalf("%s: %v", c.name, err)
+		}
+		if sb.String() != c.want {
+			t.Errorf("%s: ToCSV = %q, want %q", c.name, sb.String(), c.want)
+		}
+	}
+}
+
+func TestMarshalJSON(t *testing.T) {
+	cases := []struct {
+		name    string
+		m       *Matrix
+		want    string
+		wantErr bool
+	}{
+		{"plain", fromRows([]float64{1, 2.5}, []float64{-3, 0}), "[[1,2.5],[-3,0]]", false},
+		{"empty", NewMatrix(0, 0), "[]", false},
+		{"nan", fromRows([]float64{math.NaN()}), "", true},
+		{"inf", fromRows([]float64{math.Inf(-1)}), "", true},
+	}
+	for _, c := range cases {
+		got, err := c.m.MarshalJSON()
+		if (err != nil) != c.wantErr {
+			t.Errorf("%s: err = %v, want error %v", c.name, err, c.wantErr)
+			continue
+		}
+		if string(got) != c.want {
+			t.Errorf("%s: MarshalJSON = %s, want %s", c.name, got, c.want)
+		}
+	}
+}
+
+func TestFormatTable(t *testing.T) {
+	nan, inf := math.NaN(), math.Inf(1)
+	cases := []struct {
+		name string
+		m    *Matrix
+		prec int
+		want string
+	}{
+		{"minimum width", fromRows([]float64{1, 2.5}, []float64{-3, 0}), 1,
+			"[000]        1.0        2.5\n" +
+				"[001]       -3.0        0.0\n"},
+		{"widest value", fromRows([]float64{1, 123456789012}), 0,
+			"[000]            1 123456789012\n"},
+		// NaN and Inf are right-aligned but do not set the width
+		{"nan and inf", fromRows([]float64{nan, inf, -123456789012.5}), 1,
+			"[000]             NaN            +Inf -123456789012.5\n"},
+		{"only nan", fromRows([]float64{nan, -inf}), 2,
+			"[000]        NaN       -Inf\n"},
+		{"empty", NewMatrix(0, 0), 2, ""},
+	}
+	for _, c := range cases {
+		if got := c.m.FormatTable(c.prec); got != c.want {
+			t.Errorf("%s: FormatTable =\n%q\nwant\n%q", c.name, got, c.want)
+		}
+	}
+}
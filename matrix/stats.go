@@ -0,0 +1,125 @@
+package matrix
+
+import (
+	"math"
+	"sort"
+)
+
+// Mean returns the arithmetic mean of the values (NaN when empty).
+func (v *Vector) Mean() float64 {
+	return Mean(v.Values)
+}
+
+// StdDev returns the sample standard deviation of the values (0 for fewer
+// than two values).
+func (v *Vector) StdDev() float64 {
+	return StdDev(v.Values)
+}
+
+// Median returns the median of the values (NaN when empty).
+func (v *Vector) Median() float64 {
+	return Median(v.Values)
+}
+
+// TrimmedMean returns the mean after dropping the lowest and highest frac of
+// the values (see TrimmedMean).
+func (v *Vector) TrimmedMean(frac float64) float64 {
+	return TrimmedMean(v.Values, frac)
+}
+
+// MinMax returns the smallest and largest value (NaN, NaN when empty).
+func (v *Vector) MinMax() (float64, float64) {
+	return MinMax(v.Values)
+}
+
+// Mean returns the arithmetic mean of values (NaN when empty). It uses a
+// running mean so large values do not lose precision in a big sum.
+func Mean(values []float64) float64 {
+	if len(values) == 0 {
+		return math.NaN()
+	}
+	mean := 0.0
+	for i, x := range values {
+		mean += (x - mean) / float64(i+1)
+	}
+	return mean
+}
+
+// StdDev returns the sample standard deviation of values, computed with
+// Welford's algorithm (0 for fewer than two values).
+func StdDev(values []float64) float64 {
+	if len(values) < 2 {
+		return 0
+	}
+	mean, m2 := 0.0, 0.0
+	for i, x := range values {
+		d := x - mean
+		mean += d / float64(i+1)
+		m2 += d * (x - mean)
+	}
+	return math.Sqrt(m2 / float64(len(values)-1))
+}
+
+// Median returns the median of values (NaN when empty); values is not
+// modified.
+func Median(values []float64) float64 {
+	n := len(values)
+	if n == 0 {
+		return math.NaN()
+	}
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	if n%2 == 1 {
+		return sorted[n/2]
+	}
+	return (sorted[n/2-1] + sorted[n/2]) / 2
+}
+
+// TrimmedMean returns the mean of values after dropping floor(frac*n) of the
+// lowest and of the highest values. frac is clamped to [0, 0.5); 0 gives Mean.
+func TrimmedMean(values []float64, frac float64) float64 {
+	n := len(values)
+	if n == 0 {
+		return math.NaN()
+	}
+	frac = math.Max(0, math.Min(frac, 0.4999))
+	k := int(frac * float64(n))
+	sorted := append([]float64(nil), values...)
+	sort.Float64s(sorted)
+	return Mean(sorted[k : n-k])
+}
+
+// MinMax returns the smallest and largest of values (NaN, NaN when empty).
+func MinMax(values []float64) (float64, float64) {
+	if len(values) == 0 {
+		return math.NaN(), math.NaN()
+	}
+	lo, hi := values[0], values[0]
+	for _, x := range values[1:] {
+		lo, hi = math.Min(lo, x), math.Max(hi, x)
+	}
+	return lo, hi
+}
+
+// Float64s converts ADC counts to float64 for the statistics helpers.
+func Float64s(values []int64) []float64 {
+	out := make([]float64, len(values))
+	for i, x := range values {
+		out[i] = float64(x)
+	}
+	return out
+}
+
+// MeanInt64 is Mean for ADC counts.
+func MeanInt64(values []int64) float64 { return Mean(Float64s(values)) }
+
+// StdDevInt64 is StdDev for ADC counts.
+func StdDevInt64(values []int64) float64 { return StdDev(Float64s(values)) }
+
+// MedianInt64 is Median for ADC counts.
+func MedianInt64(values []int64) float64 { return Median(Float64s(values)) }
+
+// TrimmedMeanInt64 is TrimmedMean for ADC counts.
+func TrimmedMeanInt64(values []int64, frac float64) float64 {
+	return TrimmedMean(Float64s(values), frac)
+}
@@ -0,0 +1,128 @@
+package matrix
+
+import (
+	"math"
+	"math/rand"
+	"sort"
+	"testing"
+	"testing/quick"
+)
+
+// naiveMeanVar is the textbook two-pass mean and sample variance.
+func naiveMeanVar(values []float64) (mean, variance float64) {
+	for _, x := range values {
+		mean += x
+	}
+	mean /= float64(len(values))
+	for _, x := range values {
+		variance += (x - mean) * (x - mean)
+	}
+	return mean, variance / float64(len(values)-1)
+}
+
+// approxEqual reports whether got is within a relative tol of want.
+func approxEqual(got, want, tol float64) bool {
+	return math.Abs(got-want) <= tol*math.Max(1, math.Abs(want))
+}
+
+// adcLike turns quick's random values into readings shaped like ADC counts:
+// a large offset with a small spread.
+func adcLike(raw []int32) []float64 {
+	values := make([]float64, len(raw))
+	for i, r := range raw {
+		values[i] = 150e6 + float64(r%10000)
+	}
+	return values
+}
+
+func TestMeanStdDevMatchTwoPass(t *testing.T) {
+	prop := func(raw []int32) bool {
+		if len(raw) < 2 {
+			return true
+		}
+		values := adcLike(raw)
+		mean, variance := naiveMeanVar(values)
+		return approxEqual(Mean(values), mean, 1e-12) && approxEqual(StdDev(values), math.Sqrt(variance), 1e-6)
+	}
+	if err := quick.Check(prop, &quick.Config{Rand: rand.New(rand.NewSource(1)), MaxCount: 500}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestOrderStatistics(t *testing.T) {
+	prop := func(raw []int32, frac8 uint8) bool {
+		if len(raw) == 0 {
+			return true
+		}
+		values := adcLike(raw)
+		orig := append([]float64(nil), values...)
+		sorted := append([]float64(nil), values...)
+		sort.Float64s(sorted)
+		n := len(sorted)
+
+		below, above := 0, 0
+		med := Median(values)
+		for _, x := range values {
+			if x < med {
+				below++
+			} else if x > med {
+				above++
+			}
+		}
+		frac := float64(frac8) / 255 * 0.45
+		k := int(frac * float64(n))
+		trimmed, _ := naiveMeanVar(sorted[k : n-k])
+		lo, hi := MinMax(values)
+		for i := range values {
+			if values[i] != orig[i] {
+				return false // the helpers must not reorder their input
+			}
+		}
+		return below <= n/2 && above <= n/2 &&
+			approxEqual(TrimmedMean(values, frac), trimmed, 1e-12) &&
+			lo == sorted[0] && hi == sorted[n-1]
+	}
+	if err := quick.Check(prop, &quick.Config{Rand: rand.New(rand.NewSource(2)), MaxCount: 500}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestInt64VariantsMatch(t *testing.T) {
+	prop := func(raw []int64) bool {
+		if len(raw) < 2 {
+			return true
+		}
+		for i := range raw {
+			raw[i] %= 1 << 40 // keep counts exact in a float64
+		}
+		f := Float64s(raw)
+		return MeanInt64(raw) == Mean(f) && StdDevInt64(raw) == StdDev(f) &&
+			MedianInt64(raw) == Median(f) && TrimmedMeanInt64(raw, 0.1) == TrimmedMean(f, 0.1)
+	}
+	if err := quick.Check(prop, &quick.Config{Rand: rand.New(rand.NewSource(3))}); err != nil {
+		t.Error(err)
+	}
+}
+
+func TestStatsEdgeCases(t *testing.T) {
+	if !math.IsNaN(Mean(nil)) || !math.IsNaN(Median(nil)) || !math.IsNaN(TrimmedMean(nil, 0.1)) {
+		t.Error("empty input does not give NaN")
+	}
+	if lo, hi := MinMax(nil); !math.IsNaN(lo) || !math.IsNaN(hi) {
+		t.Error("MinMax of nothing is not NaN, NaN")
+	}
+	if StdDev([]float64{5}) != 0 {
+		t.Error("StdDev of one value is not 0")
+	}
+	if got := Median([]float64{4, 1, 3, 2}); got != 2.5 {
+		t.Errorf("even Median = %g, want 2.5", got)
+	}
+	// frac 0.5 and above is clamped so at least one value is kept
+	if got := TrimmedMean([]float64{1, 2, 100}, 0.9); got != 2 {
+		t.Errorf("TrimmedMean clamped = %g, want 2", got)
+	}
+	v := &Vector{Length: 3, Values: []float64{1, 2, 6}}
+	if v.Mean() != 3 || v.Median() != 2 || v.StdDev() != math.Sqrt(7) {
+		t.Errorf("Vector stats = %g %g %g", v.Mean(), v.Median(), v.StdDev())
+	}
+}
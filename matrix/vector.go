@@ -32,11 +32,30 @@ func (v *Vector) Norm() float64 {
 }
 
 func (v *Vector) Sub(other *Vector) *Vector {
-	result := NewVector(v.Length)
+	return v.SubInto(NewVector(v.Length), other)
+}
+
+// SubInto stores v - other in dst and returns it; dst may be v itself.
+func (v *Vector) SubInto(dst, other *Vector) *Vector {
 	for i := range v.Values {
-		result.Values[i] = v.Values[i] - other.Values[i]
+		dst.Values[i] = v.Values[i] - other.Values[i]
 	}
-	return result
+	return dst
+}
+
+// Without returns a copy of v without the entries listed in drop.
+func (v *Vector) Without(drop []int) *Vector {
+	skip := make(map[int]bool, len(drop))
+	for _, i := range drop {
+		skip[i] = true
+	}
+	values := make([]float64, 0, v.Length)
+	for i, val := range v.Values {
+		if !skip[i] {
+			values = append(values, val)
+		}
+	}
+	return &Vector{Length: len(values), Values: values}
 }
 
 func (v *Vector) ToStrings(title, format string) (string, string) {
@@ -47,12 +66,11 @@ func (v *Vector) ToStrings(title, format string) (string, string) {
 	if format != "" {
 		fmtStr = format
 	}
-	for i, val := range v.Values {
+	for _, val := range v.Values {
 		fmt.Fprintf(sb, fmtStr+"\n", val)
-		_ = i
 	}
 	sb.WriteString(MatrixLine)
-	return sb.String(), ""
+	return sb.String(), title + "," + csvRow(v.Values)
 }
 
 // printVector dumps a trimmed view of a vector for debugging
@@ -62,14 +80,11 @@ func PrintVector(v *Vector, title string, debug bool) {
 	}
 	fmt.Println(MatrixLine)
 	fmt.Println(title, " (", v.Length, ")")
-	max := v.Length
-	if max > 24 {
-		max = 24
-	}
-	for i := 0; i < max; i++ {
-		fmt.Printf("[%03d] %10.0f\n", i, v.Values[i])
-	}
-	if v.Length > max {
+	n := min(v.Length, 24)
+	view := NewVector(n)
+	copy(view.Values, v.Values[:n])
+	fmt.Print(view.FormatTable(0))
+	if v.Length > n {
 		fmt.Println("...")
 	}
 	fmt.Println(MatrixLine)
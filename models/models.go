@@ -1,5 +1,10 @@
 package models
 
+import (
+	"math"
+	"strconv"
+)
+
 // Constants related to layout
 const (
 	MAXLCS   = 4
@@ -26,7 +31,7 @@ func (l LMR) String() string {
 	case RIGHT:
 		return "RIGHT"
 	default:
-		return "LMR(" + string(int(l)) + ")"
+		return "LMR(" + strconv.Itoa(int(l)) + ")"
 	}
 }
 
@@ -44,7 +49,7 @@ func (f FB) String() string {
 	case BACK:
 		return "BACK"
 	default:
-		return "FB(" + string(int(f)) + ")"
+		return "FB(" + strconv.Itoa(int(f)) + ")"
 	}
 }
 
@@ -80,19 +85,125 @@ func (b BAY) String() string {
 	case EIGHTH:
 		return "EIGHTH"
 	default:
-		return "BAY(" + string(int(b)) + ")"
+		return "BAY(" + strconv.Itoa(int(b)) + ")"
 	}
 }
 
 // Data models
 type PARAMETERS struct {
+	// SCHEMA is the layout version of the file (see SchemaVersion); files
+	// without it are schema 0.
+	SCHEMA  int      `json:"SCHEMA,omitempty"`
 	SERIAL  *SERIAL  `json:"SERIAL"`
 	VERSION *VERSION `json:"VERSION,omitempty"`
-	WEIGHT  int      `json:"WEIGHT"`
-	AVG     int      `json:"AVG"`
-	IGNORE  int      `json:"IGNORE,omitempty"`
-	DEBUG   bool     `json:"DEBUG"`
-	BARS    []*BAR   `json:"BARS"`
+	// MINVERSION is the oldest firmware MAJOR.MINOR accepted without a
+	// warning; ID is ignored.
+	MINVERSION *VERSION `json:"MINVERSION,omitempty"`
+	WEIGHT     float64  `json:"WEIGHT"`
+	AVG        int      `json:"AVG"`
+	IGNORE     int      `json:"IGNORE,omitempty"`
+	DEBUG      bool     `json:"DEBUG"`
+	BARS       []*BAR   `json:"BARS"`
+	META       *META    `json:"META,omitempty"`
+	// VERSIONED keeps a timestamped copy of every calibrated file next to
+	// the stable config_calibrated.json.
+	VERSIONED bool  `json:"VERSIONED,omitempty"`
+	TEST      *TEST `json:"TEST,omitempty"`
+	// REGULARIZATION enables ridge damping of the factor solve for nearly
+	// collinear placements, as a fraction of the largest singular value
+	// (e.g. 1e-4); 0 keeps the plain pseudoinverse.
+	REGULARIZATION float64 `json:"REGULARIZATION,omitempty"`
+	// WEIGHTED downweights placement steps whose samples were noisier than
+	// the median step in the factor fit.
+	WEIGHTED bool `json:"WEIGHTED,omitempty"`
+	// ALLOWPARTIAL lets the factor fit drop placement steps that recorded no
+	// load instead of refusing to compute.
+	ALLOWPARTIAL bool `json:"ALLOWPARTIAL,omitempty"`
+	// SHELF is an optional name for the shelf, shown in prompts.
+	SHELF string `json:"SHELF,omitempty"`
+	// CAPACITY is the optional rated load of the whole shelf, in the unit of
+	// WEIGHT; the live test flags a grand total above it.
+	CAPACITY float64 `json:"CAPACITY,omitempty"`
+	// GEOMETRY optionally renames the positions used in placement prompts.
+	GEOMETRY *GEOMETRY `json:"GEOMETRY,omitempty"`
+	// FILESERIAL is the SERIAL block as read from the file when the port or
+	// baud rate was overridden at load time (nil otherwise). Overrides are
+	// never written back.
+	FILESERIAL *SERIAL `json:"-"`
+}
+
+// GEOMETRY holds custom names for the placement positions of a shelf. Empty
+// or missing entries keep the BAY, LMR and FB wording; the order and number
+// of placement steps do not change.
+type GEOMETRY struct {
+	BAYS   []string `json:"BAYS,omitempty"`   // one name per bay, first bay first
+	SIDES  []string `json:"SIDES,omitempty"`  // names for LEFT, MIDDLE, RIGHT
+	DEPTHS []string `json:"DEPTHS,omitempty"` // names for FRONT, BACK
+}
+
+// Bay returns the name of bay b.
+func (g *GEOMETRY) Bay(b BAY) string {
+	if g != nil && int(b) >= 0 && int(b) < len(g.BAYS) && g.BAYS[b] != "" {
+		return g.BAYS[b]
+	}
+	return b.String()
+}
+
+// Side returns the name of side s.
+func (g *GEOMETRY) Side(s LMR) string {
+	if g != nil && int(s) >= 0 && int(s) < len(g.SIDES) && g.SIDES[s] != "" {
+		return g.SIDES[s]
+	}
+	return s.String()
+}
+
+// Depth returns the name of depth d.
+func (g *GEOMETRY) Depth(d FB) string {
+	if g != nil && int(d) >= 0 && int(d) < len(g.DEPTHS) && g.DEPTHS[d] != "" {
+		return g.DEPTHS[d]
+	}
+	return d.String()
+}
+
+// TEST holds optional live test settings; zero values select the defaults.
+type TEST struct {
+	// STABLEBAND is how far the grand total may move while still counting
+	// as settled, in the same unit as WEIGHT.
+	STABLEBAND float64 `json:"STABLEBAND,omitempty"`
+	// STABLEMS is how long the grand total must stay within STABLEBAND
+	// before it is reported as stable.
+	STABLEMS int `json:"STABLEMS,omitempty"`
+	// CORNERTOL is the allowed deviation from WEIGHT at each position of the
+	// corner test; 0 selects 1% of WEIGHT.
+	CORNERTOL float64 `json:"CORNERTOL,omitempty"`
+	// CYCLES is the number of load/unload cycles of the repeatability test;
+	// 0 selects 5.
+	CYCLES int `json:"CYCLES,omitempty"`
+	// REPEATMAX is the largest allowed deviation of a repeatability reading
+	// from the mean; 0 selects 0.5% of WEIGHT.
+	REPEATMAX float64 `json:"REPEATMAX,omitempty"`
+	// FACTORMIN and FACTORMAX bound the magnitude of factors read back from
+	// the bars; 0 selects 1e-6 and 1e2.
+	FACTORMIN float64 `json:"FACTORMIN,omitempty"`
+	FACTORMAX float64 `json:"FACTORMAX,omitempty"`
+	// ZEROEVERY is how many zero samples pass between reports of the running
+	// zero estimates during a live test; 0 selects 5.
+	ZEROEVERY int `json:"ZEROEVERY,omitempty"`
+}
+
+// META records how and when a calibrated file was produced. It is written by
+// SaveToJSON for traceability only; flashing and testing never read it.
+type META struct {
+	CREATED    string     `json:"CREATED"`
+	APPVERSION string     `json:"APPVERSION"`
+	APPBUILD   string     `json:"APPBUILD"`
+	PORT       string     `json:"PORT,omitempty"`
+	FIRMWARE   []*VERSION `json:"FIRMWARE,omitempty"`
+	WEIGHT     float64    `json:"WEIGHT,omitempty"`
+	ERROR      float64    `json:"ERROR,omitempty"`
+	PINVNORM   float64    `json:"PINVNORM,omitempty"`
+	CONDITION  float64    `json:"CONDITION,omitempty"` // omitted when rank deficient
+	PLAN       string     `json:"PLAN,omitempty"`
 }
 
 type SENTINEL struct {
@@ -116,10 +227,61 @@ type BAR struct {
 	ID  int   `json:"ID"`
 	LCS byte  `json:"LCS"`
 	LC  []*LC `json:"LC,omitempty"`
+	// NAME is an optional friendly name such as "Middle shelf".
+	NAME string `json:"NAME,omitempty"`
+	// CAPACITY is the optional rated load of the bar, in the unit of WEIGHT;
+	// the live test flags a bar total above it.
+	CAPACITY float64 `json:"CAPACITY,omitempty"`
 }
 
+// Name returns the NAME of bar i (0-based), or "Bar <i+1>" when unset.
+func (b *BAR) Name(i int) string {
+	if b != nil && b.NAME != "" {
+		return b.NAME
+	}
+	return "Bar " + strconv.Itoa(i+1)
+}
+
+// LCLabel returns the LABEL of load cell j (0-based), or "LC <j+1>" when unset.
+func (b *BAR) LCLabel(j int) string {
+	if b != nil && j < len(b.LC) && b.LC[j] != nil && b.LC[j].LABEL != "" {
+		return b.LC[j].LABEL
+	}
+	return "LC " + strconv.Itoa(j+1)
+}
+
+// LC is the calibration of one load cell. ZERO is the averaged no-load
+// reading in ADC counts; it may be fractional or (after drift) negative.
+// Older files stored it as an unsigned integer, which decodes unchanged.
 type LC struct {
-	ZERO   uint64  `json:"ZERO"`
+	ZERO   float64 `json:"ZERO"`
 	FACTOR float32 `json:"FACTOR"`
 	IEEE   string  `json:"IEEE"`
+	// LABEL is an optional friendly name such as "rear-left".
+	LABEL string `json:"LABEL,omitempty"`
+}
+
+// IsCalibrated reports whether the parameters already carry usable factors:
+// every bar has a non-empty LC slice and every factor is finite and nonzero.
+// This is used instead of the "_calibrated.json" filename suffix so renamed
+// calibrated files are still recognised.
+func (p *PARAMETERS) IsCalibrated() bool {
+	if p == nil || len(p.BARS) == 0 {
+		return false
+	}
+	for _, bar := range p.BARS {
+		if bar == nil || len(bar.LC) == 0 {
+			return false
+		}
+		for _, lc := range bar.LC {
+			if lc == nil {
+				return false
+			}
+			f := float64(lc.FACTOR)
+			if f == 0 || math.IsNaN(f) || math.IsInf(f, 0) {
+				return false
+			}
+		}
+	}
+	return true
 }
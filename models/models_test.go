@@ -0,0 +1,65 @@
+package models
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestGeometryNames(t *testing.T) {
+	var none *GEOMETRY
+	if got := none.Bay(SECOND) + " " + none.Side(MIDDLE) + " " + none.Depth(BACK); got != "SECOND MIDDLE BACK" {
+		t.Errorf("nil GEOMETRY names = %q", got)
+	}
+	// empty and missing entries keep the default wording
+	g := &GEOMETRY{BAYS: []string{"Bay A"}, SIDES: []string{"", "Centre"}, DEPTHS: []string{"Aisle"}}
+	for _, tc := range []struct{ got, want string }{
+		{g.Bay(FIRST), "Bay A"},
+		{g.Bay(SECOND), "SECOND"},
+		{g.Side(LEFT), "LEFT"},
+		{g.Side(MIDDLE), "Centre"},
+		{g.Side(RIGHT), "RIGHT"},
+		{g.Depth(FRONT), "Aisle"},
+		{g.Depth(BACK), "BACK"},
+	} {
+		if tc.got != tc.want {
+			t.Errorf("name = %q, want %q", tc.got, tc.want)
+		}
+	}
+}
+
+// validParameters returns a config that passes Validate, with three bars
+// and so two bays.
+func validParameters() *PARAMETERS {
+	return &PARAMETERS{
+		SERIAL: &SERIAL{PORT: "COM3", BAUDRATE: 115200, COMMAND: "M"},
+		WEIGHT: 500,
+		AVG:    10,
+		BARS:   []*BAR{{ID: 1, LCS: 15}, {ID: 2, LCS: 15}, {ID: 3, LCS: 15}},
+	}
+}
+
+func TestValidateGeometry(t *testing.T) {
+	p := validParameters()
+	p.GEOMETRY = &GEOMETRY{BAYS: []string{"A", "B"}, SIDES: []string{"L", "M", "R"}, DEPTHS: []string{"F", "B"}}
+	if err := p.Validate(); err != nil {
+		t.Fatalf("full GEOMETRY rejected: %v", err)
+	}
+
+	p.GEOMETRY = &GEOMETRY{BAYS: []string{"A", "B", "C"}, SIDES: make([]string, 4), DEPTHS: make([]string, 3)}
+	err := p.Validate()
+	if err == nil {
+		t.Fatal("too many GEOMETRY names accepted")
+	}
+	paths := map[string]bool{}
+	for _, e := range err.(interface{ Unwrap() []error }).Unwrap() {
+		var verr *ValidationError
+		if errors.As(e, &verr) {
+			paths[verr.Path] = true
+		}
+	}
+	for _, path := range []string{"GEOMETRY.BAYS", "GEOMETRY.SIDES", "GEOMETRY.DEPTHS"} {
+		if !paths[path] {
+			t.Errorf("no error for %s in %v", path, err)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package models
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"strconv"
+)
+
+// SchemaVersion is the SCHEMA written by this version of the tool.
+const SchemaVersion = 1
+
+// migrations[n] upgrades a decoded file from schema n to n+1.
+var migrations = []func(raw map[string]interface{}) error{
+	migrateV0,
+}
+
+// Migrate upgrades a config or calibrated file, decoded into a generic map
+// (numbers as float64 or, to keep large integers exact, json.Number), to
+// SchemaVersion in place and returns the schema it was read as. Files from a
+// newer schema are refused since they may carry fields this version would
+// misread or drop.
+func Migrate(raw map[string]interface{}) (int, error) {
+	from := 0
+	if v, ok := raw["SCHEMA"]; ok && v != nil {
+		n, ok := toFloat(v)
+		if !ok || n != float64(int(n)) || n < 0 {
+			return 0, &ValidationError{Path: "SCHEMA", Message: fmt.Sprintf("must be a non-negative integer, got %v", v)}
+		}
+		from = int(n)
+	}
+	if from > SchemaVersion {
+		return from, &ValidationError{Path: "SCHEMA", Message: fmt.Sprintf("file uses schema %d but this version reads up to %d; update the tool", from, SchemaVersion)}
+	}
+	for n := from; n < SchemaVersion; n++ {
+		if err := migrations[n](raw); err != nil {
+			return from, fmt.Errorf("migrating from schema %d: %w", n, err)
+		}
+		raw["SCHEMA"] = float64(n + 1)
+	}
+	return from, nil
+}
+
+// migrateV0 upgrades files written before SCHEMA existed: plain configs and
+// the _calibrated.json payload. WEIGHT was an integer and becomes a float,
+// and each LC.ZERO was an unsigned integer and becomes a float. A zero that
+// went slightly negative was stored wrapped around to nearly 2^64; it is
+// restored to its negative value.
+func migrateV0(raw map[string]interface{}) error {
+	if v, ok := raw["WEIGHT"]; ok && v != nil {
+		w, ok := toFloat(v)
+		if !ok {
+			return &ValidationError{Path: "WEIGHT", Message: "must be a number, got " + jsonText(v)}
+		}
+		raw["WEIGHT"] = w
+	}
+	bars, _ := raw["BARS"].([]interface{})
+	for i, b := range bars {
+		bar, _ := b.(map[string]interface{})
+		lcs, _ := bar["LC"].([]interface{})
+		for j, l := range lcs {
+			lc, _ := l.(map[string]interface{})
+			v, ok := lc["ZERO"]
+			if !ok || v == nil {
+				continue
+			}
+			zero, ok := legacyZero(v)
+			if !ok {
+				return &ValidationError{Path: fmt.Sprintf("BARS[%d].LC[%d].ZERO", i, j), Message: "must be a number, got " + jsonText(v)}
+			}
+			lc["ZERO"] = zero
+		}
+	}
+	raw["SCHEMA"] = float64(1)
+	return nil
+}
+
+// legacyZero converts a schema 0 ZERO to a float64, undoing the uint64
+// wrap-around of negative zeros when the exact integer is available.
+func legacyZero(v interface{}) (float64, bool) {
+	if n, ok := v.(json.Number); ok {
+		if u, err := strconv.ParseUint(n.String(), 10, 64); err == nil && u > math.MaxInt64 {
+			return float64(int64(u)), true
+		}
+	}
+	z, ok := toFloat(v)
+	if ok && z > math.MaxInt64 {
+		// exact value lost in decoding; the wrapped value is still near 2^64
+		z -= math.Exp2(64)
+	}
+	return z, ok
+}
+
+// toFloat returns the JSON number v as a float64.
+func toFloat(v interface{}) (float64, bool) {
+	switch n := v.(type) {
+	case float64:
+		return n, true
+	case json.Number:
+		f, err := n.Float64()
+		return f, err == nil
+	}
+	return 0, false
+}
+
+// jsonText returns v as it appears in the file, for error messages.
+func jsonText(v interface{}) string {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return fmt.Sprint(v)
+	}
+	return string(b)
+}
@@ -0,0 +1,79 @@
+package models
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"testing"
+)
+
+// decode reads data the way file.LoadParameters hands it to Migrate.
+func decode(t *testing.T, data string) map[string]interface{} {
+	t.Helper()
+	dec := json.NewDecoder(bytes.NewReader([]byte(data)))
+	dec.UseNumber()
+	var raw map[string]interface{}
+	if err := dec.Decode(&raw); err != nil {
+		t.Fatal(err)
+	}
+	return raw
+}
+
+func TestMigrateV0(t *testing.T) {
+	raw := decode(t, `{"WEIGHT": 500, "BARS": [{"ID": 1, "LCS": 3, "LC": [
+		{"ZERO": 148672864, "FACTOR": 0.00028},
+		{"ZERO": 18446744073709551613, "FACTOR": 0.00029}]}, {"ID": 2, "LCS": 3}]}`)
+	from, err := Migrate(raw)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if from != 0 || raw["SCHEMA"] != float64(SchemaVersion) {
+		t.Errorf("read as schema %d, stamped %v; want 0 and %d", from, raw["SCHEMA"], SchemaVersion)
+	}
+	if raw["WEIGHT"] != float64(500) {
+		t.Errorf("WEIGHT = %#v, want float64 500", raw["WEIGHT"])
+	}
+	lcs := raw["BARS"].([]interface{})[0].(map[string]interface{})["LC"].([]interface{})
+	for i, want := range []float64{148672864, -3} {
+		if got := lcs[i].(map[string]interface{})["ZERO"]; got != want {
+			t.Errorf("LC %d ZERO = %#v, want float64 %g", i+1, got, want)
+		}
+	}
+
+	// the same file read without json.Number still restores the sign
+	var plain map[string]interface{}
+	if err := json.Unmarshal([]byte(`{"BARS": [{"LC": [{"ZERO": 18446744073709551613}]}]}`), &plain); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Migrate(plain); err != nil {
+		t.Fatal(err)
+	}
+	if z := plain["BARS"].([]interface{})[0].(map[string]interface{})["LC"].([]interface{})[0].(map[string]interface{})["ZERO"].(float64); z > 0 {
+		t.Errorf("wrapped ZERO migrated to %g, want it no longer near 2^64", z)
+	}
+}
+
+func TestMigrateRejects(t *testing.T) {
+	for name, data := range map[string]string{
+		"newer schema":  `{"SCHEMA": 99}`,
+		"bad schema":    `{"SCHEMA": "one"}`,
+		"string weight": `{"WEIGHT": "500"}`,
+		"string zero":   `{"BARS": [{"LC": [{"ZERO": "1"}]}]}`,
+	} {
+		_, err := Migrate(decode(t, data))
+		var verr *ValidationError
+		if !errors.As(err, &verr) {
+			t.Errorf("%s: err = %v, want a ValidationError", name, err)
+		}
+	}
+}
+
+func TestMigrateCurrentUnchanged(t *testing.T) {
+	raw := decode(t, `{"SCHEMA": 1, "WEIGHT": 500, "BARS": [{"LC": [{"ZERO": 12}]}]}`)
+	if from, err := Migrate(raw); err != nil || from != SchemaVersion {
+		t.Fatalf("Migrate = %d, %v", from, err)
+	}
+	if _, ok := raw["WEIGHT"].(json.Number); !ok {
+		t.Errorf("current file was migrated: WEIGHT = %#v", raw["WEIGHT"])
+	}
+}
@@ -0,0 +1,145 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// MAXBARID is the highest bar ID the protocol can address: the ID is sent as
+// a single byte offset from '0' (see serial.GetCommand).
+const MAXBARID = 255 - '0'
+
+// ValidationError describes one invalid field, identified by its JSON path
+// (e.g. "BARS[1].LCS").
+type ValidationError struct {
+	Path    string
+	Message string
+}
+
+func (e *ValidationError) Error() string { return e.Path + ": " + e.Message }
+
+// Validate checks the parameters for mistakes that would otherwise only show
+// up later as serial errors or a divide-by-zero. Every problem found is
+// reported as a *ValidationError; they are combined with errors.Join. A
+// calibrated file does not need WEIGHT since it is only used to calibrate.
+func (p *PARAMETERS) Validate() error {
+	var errs []error
+	add := func(path, format string, a ...interface{}) {
+		errs = append(errs, &ValidationError{Path: path, Message: fmt.Sprintf(format, a...)})
+	}
+
+	if p.SERIAL == nil {
+		add("SERIAL", "missing")
+	} else {
+		if p.SERIAL.BAUDRATE <= 0 {
+			add("SERIAL.BAUDRATE", "must be positive, got %d", p.SERIAL.BAUDRATE)
+		}
+		if p.SERIAL.COMMAND == "" {
+			add("SERIAL.COMMAND", "missing")
+		}
+	}
+
+	if p.AVG <= 0 {
+		add("AVG", "must be positive, got %d", p.AVG)
+	}
+	if p.IGNORE < 0 {
+		add("IGNORE", "must not be negative, got %d", p.IGNORE)
+	}
+	if p.WEIGHT < 0 || (p.WEIGHT == 0 && !p.IsCalibrated()) {
+		add("WEIGHT", "must be positive, got %g", p.WEIGHT)
+	}
+
+	if p.REGULARIZATION < 0 {
+		add("REGULARIZATION", "must not be negative, got %g", p.REGULARIZATION)
+	}
+
+	if p.CAPACITY < 0 {
+		add("CAPACITY", "must not be negative, got %g", p.CAPACITY)
+	}
+
+	if g := p.GEOMETRY; g != nil {
+		if len(g.SIDES) > 3 {
+			add("GEOMETRY.SIDES", "%d names for 3 sides", len(g.SIDES))
+		}
+		if len(g.DEPTHS) > 2 {
+			add("GEOMETRY.DEPTHS", "%d names for 2 depths", len(g.DEPTHS))
+		}
+		if len(p.BARS) > 0 && len(g.BAYS) > len(p.BARS)-1 {
+			add("GEOMETRY.BAYS", "%d names for %d bays", len(g.BAYS), len(p.BARS)-1)
+		}
+	}
+
+	if len(p.BARS) == 0 {
+		add("BARS", "no bars defined")
+	}
+	if err := CheckBarIDs(p.BARS); err != nil {
+		errs = append(errs, err)
+	}
+	for i, bar := range p.BARS {
+		path := fmt.Sprintf("BARS[%d]", i)
+		if bar == nil {
+			add(path, "missing")
+			continue
+		}
+		if bar.CAPACITY < 0 {
+			add(path+".CAPACITY", "must not be negative, got %g", bar.CAPACITY)
+		}
+		if bar.LCS == 0 {
+			add(path+".LCS", "no active load cells")
+			continue
+		}
+		if bar.LCS>>MAXLCS != 0 {
+			add(path+".LCS", "mask 0x%02X has bits above the %d supported load cells", bar.LCS, MAXLCS)
+		}
+		n := ActiveLCs(bar.LCS)
+		if len(bar.LC) > 0 && len(bar.LC) != n {
+			add(path+".LC", "%d entries for %d active load cells", len(bar.LC), n)
+		}
+	}
+	return errors.Join(errs...)
+}
+
+// CheckBarIDs reports bar IDs the protocol cannot address and IDs shared by
+// several bars, naming every position that uses a duplicated ID. Two bars
+// with one ID would both be answered by the same device. nil bars are skipped.
+func CheckBarIDs(bars []*BAR) error {
+	var errs []error
+	positions := make(map[int][]int)
+	var order []int
+	for i, bar := range bars {
+		if bar == nil {
+			continue
+		}
+		if bar.ID < 0 || bar.ID > MAXBARID {
+			errs = append(errs, &ValidationError{Path: fmt.Sprintf("BARS[%d].ID", i), Message: fmt.Sprintf("%d is outside 0..%d", bar.ID, MAXBARID)})
+		}
+		if _, ok := positions[bar.ID]; !ok {
+			order = append(order, bar.ID)
+		}
+		positions[bar.ID] = append(positions[bar.ID], i)
+	}
+	for _, id := range order {
+		at := positions[id]
+		if len(at) < 2 {
+			continue
+		}
+		paths := make([]string, len(at))
+		for k, i := range at {
+			paths[k] = fmt.Sprintf("BARS[%d]", i)
+		}
+		errs = append(errs, &ValidationError{Path: paths[1] + ".ID", Message: fmt.Sprintf("ID %d is used by %s", id, strings.Join(paths, ", "))})
+	}
+	return errors.Join(errs...)
+}
+
+// ActiveLCs returns the number of load cells enabled in an LCS mask.
+func ActiveLCs(lcs byte) int {
+	count := 0
+	for i := 0; i < 8; i++ {
+		if (lcs & (1 << i)) != 0 {
+			count++
+		}
+	}
+	return count
+}
@@ -2,12 +2,15 @@ package serial
 
 import (
 	"bytes"
+	"context"
 	"encoding/binary"
+	"errors"
 	"fmt"
 	"log"
 	"math"
 	"strconv"
 	"strings"
+	"sync"
 	"time"
 
 	models "github.com/CK6170/Calrunrilla-go/models"
@@ -17,14 +20,101 @@ import (
 const Euler = "27182818284590452353602874713527\r"
 
 type Leo485 struct {
-	Serial       *goserial.Port
+	port         *goserial.Port // nil after Close or a failed Reconnect
 	Bars         []*models.BAR
-	NLCs         int
 	SerialConfig *models.SERIAL
+	nlcs         []int // active load cells of each bar
+	offsets      []int // index of each bar's first load cell in a flat layout
+	// mu is the session lock: it is held for every exchange on port and
+	// while Reconnect swaps the port.
+	mu sync.Mutex
 }
 
+// errNotConnected is returned by exchanges after Close or a failed Reconnect.
+var errNotConnected = errors.New("serial port not connected")
+
 func NewLeo485(ser *models.SERIAL, bars []*models.BAR) *Leo485 {
-	config := &goserial.Config{
+	l, err := OpenLeo485(ser, bars)
+	if err != nil {
+		log.Fatal(err)
+	}
+	return l
+}
+
+// OpenLeo485 is NewLeo485 returning an error instead of exiting when the
+// port cannot be opened, the bar IDs are invalid (see models.CheckBarIDs) or a
+// bar has no active load cells. Bars may have different numbers of load cells.
+func OpenLeo485(ser *models.SERIAL, bars []*models.BAR) (*Leo485, error) {
+	if err := models.CheckBarIDs(bars); err != nil {
+		return nil, err
+	}
+	nlcs, offsets, err := lcLayout(bars)
+	if err != nil {
+		return nil, err
+	}
+	port, err := goserial.OpenPort(serialConfig(ser))
+	if err != nil {
+		return nil, err
+	}
+	return &Leo485{
+		port:         port,
+		Bars:         bars,
+		SerialConfig: ser,
+		nlcs:         nlcs,
+		offsets:      offsets,
+	}, nil
+}
+
+// lcLayout returns the number of active load cells of each bar and the index
+// of each bar's first load cell in a flat slice holding all bars in order.
+func lcLayout(bars []*models.BAR) (nlcs []int, offsets []int, err error) {
+	nlcs = make([]int, len(bars))
+	offsets = make([]int, len(bars))
+	total := 0
+	for i, bar := range bars {
+		nlcs[i] = numOfActiveLCs(bar.LCS)
+		if nlcs[i] == 0 {
+			return nil, nil, fmt.Errorf("bar %d has no active load cells", i+1)
+		}
+		offsets[i] = total
+		total += nlcs[i]
+	}
+	return nlcs, offsets, nil
+}
+
+// NLCsPerBar returns the number of active load cells of bar index.
+func (l *Leo485) NLCsPerBar(index int) int { return l.nlcs[index] }
+
+// LCsPerBar returns the number of active load cells of every bar.
+func (l *Leo485) LCsPerBar() []int { return append([]int(nil), l.nlcs...) }
+
+// LCOffset returns the index of the first load cell of bar index in a flat
+// slice holding the load cells of all bars in order.
+func (l *Leo485) LCOffset(index int) int { return l.offsets[index] }
+
+// TotalLCs returns the number of active load cells over all bars.
+func (l *Leo485) TotalLCs() int {
+	if len(l.nlcs) == 0 {
+		return 0
+	}
+	last := len(l.nlcs) - 1
+	return l.offsets[last] + l.nlcs[last]
+}
+
+// MaxNLCs returns the largest number of active load cells of any bar.
+func (l *Leo485) MaxNLCs() int {
+	max := 0
+	for _, n := range l.nlcs {
+		if n > max {
+			max = n
+		}
+	}
+	return max
+}
+
+// serialConfig returns the port settings used for every Leo485 connection.
+func serialConfig(ser *models.SERIAL) *goserial.Config {
+	return &goserial.Config{
 		Name:        ser.PORT,
 		Baud:        ser.BAUDRATE,
 		Parity:      goserial.ParityNone,
@@ -32,31 +122,108 @@ func NewLeo485(ser *models.SERIAL, bars []*models.BAR) *Leo485 {
 		StopBits:    goserial.Stop1,
 		ReadTimeout: time.Millisecond * 300,
 	}
-	port, err := goserial.OpenPort(config)
-	if err != nil {
-		log.Fatal(err)
+}
+
+// Reconnect recovers a connection whose adapter was unplugged or re-enumerated
+// without replacing the Leo485, so references held elsewhere stay valid. The
+// stale port is closed and the configured port reopened; if that fails or the
+// first bar does not answer the version command, the COM ports are scanned
+// and SerialConfig.PORT is updated to the port found. The session lock is held
+// throughout, so other calls on l wait for the new port. ctx stops the scan;
+// onStatus (may be nil) receives progress messages. When Reconnect fails, l
+// is left without a port and its exchanges return an error until a later
+// Reconnect succeeds.
+func (l *Leo485) Reconnect(ctx context.Context, onStatus func(string)) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	status := func(format string, a ...interface{}) {
+		if onStatus != nil {
+			onStatus(fmt.Sprintf(format, a...))
+		}
 	}
-	l := &Leo485{
-		Serial:       port,
-		Bars:         bars,
-		SerialConfig: ser,
+	status("Reconnecting to %s...", l.SerialConfig.PORT)
+	if l.port != nil {
+		_ = l.port.Close()
+		l.port = nil
+	}
+	if port, err := l.openAndProbe(l.SerialConfig.PORT); err == nil {
+		l.port = port
+		status("Reconnected on %s", l.SerialConfig.PORT)
+		return nil
 	}
-	l.NLCs = numOfActiveLCs(bars[0].LCS)
-	for _, bar := range bars {
-		if numOfActiveLCs(bar.LCS) != l.NLCs {
-			log.Fatal("Number of Load Cells per bar must match")
+	status("No answer on %s, scanning serial ports...", l.SerialConfig.PORT)
+	p := detectPort(ctx, l.Bars[0].ID, l.SerialConfig.BAUDRATE)
+	if p == "" {
+		if err := ctx.Err(); err != nil {
+			return fmt.Errorf("reconnect: %v", err)
 		}
+		return fmt.Errorf("reconnect: no port answered for bar ID %d", l.Bars[0].ID)
 	}
-	return l
+	port, err := l.openAndProbe(p)
+	if err != nil {
+		return fmt.Errorf("reconnect: %v", err)
+	}
+	l.port = port
+	l.SerialConfig.PORT = p
+	status("Reconnected on %s", p)
+	return nil
+}
+
+// openAndProbe opens the named port with the session settings and returns it
+// once the first bar answers the version command. The port is closed when it
+// does not.
+func (l *Leo485) openAndProbe(name string) (*goserial.Port, error) {
+	cfg := *l.SerialConfig
+	cfg.PORT = name
+	port, err := goserial.OpenPort(serialConfig(&cfg))
+	if err != nil {
+		return nil, err
+	}
+	if _, _, _, err := queryVersion(port, l.Bars[0].ID); err != nil {
+		_ = port.Close()
+		return nil, err
+	}
+	return port, nil
+}
+
+// withPort runs f on the open port with the session lock held, so Reconnect
+// cannot close or swap the port in the middle of an exchange.
+func (l *Leo485) withPort(f func(sp *goserial.Port) error) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.port == nil {
+		return errNotConnected
+	}
+	return f(l.port)
 }
 
 func (l *Leo485) Open() error { return nil }
 
-func (l *Leo485) Close() error { return l.Serial.Close() }
+// Close closes the port. Closing a Leo485 without a port does nothing.
+func (l *Leo485) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	if l.port == nil {
+		return nil
+	}
+	err := l.port.Close()
+	l.port = nil
+	return err
+}
 
 func (l *Leo485) GetADs(index int) ([]uint64, error) {
+	return l.GetADsTimeout(index, 200)
+}
+
+// GetADsTimeout is GetADs with an explicit response timeout in milliseconds.
+// The whole exchange takes at most about 1.5x timeout.
+func (l *Leo485) GetADsTimeout(index int, timeout int) ([]uint64, error) {
 	cmd := GetCommand(l.Bars[index].ID, []byte(l.SerialConfig.COMMAND))
-	response, err := sendCommand(l.Serial, cmd, 200)
+	var response []byte
+	err := l.withPort(func(sp *goserial.Port) (err error) {
+		response, err = sendCommand(sp, cmd, timeout)
+		return err
+	})
 	if err != nil {
 		return nil, err
 	}
@@ -75,8 +242,18 @@ func (l *Leo485) GetADs(index int) ([]uint64, error) {
 }
 
 func (l *Leo485) GetVersion(index int) (int, int, int, error) {
-	cmd := GetCommand(l.Bars[index].ID, []byte("V"))
-	response, err := getData(l.Serial, cmd, 200)
+	var id, major, minor int
+	err := l.withPort(func(sp *goserial.Port) (err error) {
+		id, major, minor, err = queryVersion(sp, l.Bars[index].ID)
+		return err
+	})
+	return id, major, minor, err
+}
+
+// queryVersion sends the version command to barID on sp and parses the reply.
+func queryVersion(sp *goserial.Port, barID int) (int, int, int, error) {
+	cmd := GetCommand(barID, []byte("V"))
+	response, err := getData(sp, cmd, 200)
 	if err != nil {
 		return 0, 0, 0, fmt.Errorf("GetVersion error: %v", err)
 	}
@@ -98,6 +275,38 @@ func (l *Leo485) GetVersion(index int) (int, int, int, error) {
 	return id, major, minor, nil
 }
 
+// exchange sends cmd on the open port with one of the com.go text helpers.
+func (l *Leo485) exchange(send func(*goserial.Port, []byte, int) (string, error), cmd []byte, timeout int) (string, error) {
+	var response string
+	err := l.withPort(func(sp *goserial.Port) (err error) {
+		response, err = send(sp, cmd, timeout)
+		return err
+	})
+	return response, err
+}
+
+// ChangeState sends cmd with changeState, holding the session lock.
+func (l *Leo485) ChangeState(cmd []byte, timeout int) (string, error) {
+	return l.exchange(changeState, cmd, timeout)
+}
+
+// UpdateValue sends cmd with updateValue, holding the session lock.
+func (l *Leo485) UpdateValue(cmd []byte, timeout int) (string, error) {
+	return l.exchange(updateValue, cmd, timeout)
+}
+
+// PrimeBootloaders sends a single CR to every bar in update mode and drains
+// any immediate reply; some bootloaders ignore the first command after Enter.
+func (l *Leo485) PrimeBootloaders(timeout int) error {
+	return l.withPort(func(sp *goserial.Port) error {
+		if _, err := sp.Write([]byte{0x0D}); err != nil {
+			return err
+		}
+		_, _ = readUntil(sp, timeout)
+		return nil
+	})
+}
+
 func (l *Leo485) WriteZeros(index int, zeros []float64, total uint64) bool {
 	sb := "O"
 	k := 0
@@ -111,7 +320,7 @@ func (l *Leo485) WriteZeros(index int, zeros []float64, total uint64) bool {
 	}
 	sb += fmt.Sprintf("%09d|", total)
 	cmd := GetCommand(l.Bars[index].ID, []byte(sb))
-	response, err := updateValue(l.Serial, cmd, 200)
+	response, err := l.exchange(updateValue, cmd, 200)
 	if err != nil {
 		return false
 	}
@@ -130,7 +339,7 @@ func (l *Leo485) WriteFactors(index int, factors []float64) bool {
 		}
 	}
 	cmd := GetCommand(l.Bars[index].ID, []byte(sb))
-	response, err := updateValue(l.Serial, cmd, 200)
+	response, err := l.exchange(updateValue, cmd, 200)
 	if err != nil {
 		return false
 	}
@@ -138,7 +347,7 @@ func (l *Leo485) WriteFactors(index int, factors []float64) bool {
 }
 
 func (l *Leo485) OpenToUpdate() error {
-	data, err := changeState(l.Serial, []byte(Euler), 1000)
+	data, err := l.exchange(changeState, []byte(Euler), 1000)
 	if err != nil {
 		return err
 	}
@@ -156,7 +365,7 @@ func (l *Leo485) OpenToUpdate() error {
 
 func (l *Leo485) Reboot(index int) bool {
 	cmd := GetCommand(l.Bars[index].ID, []byte("R"))
-	response, err := changeState(l.Serial, cmd, 200)
+	response, err := l.exchange(changeState, cmd, 200)
 	if err != nil {
 		return false
 	}
@@ -167,14 +376,50 @@ func (l *Leo485) Reboot(index int) bool {
 // Response payload format: 4 bytes totalFactor (IEEE754) followed by 4-byte IEEE754 factors
 // for each active LC. Returns slice of factors (float64) or an error.
 func (l *Leo485) ReadFactors(index int) ([]float64, error) {
-	cmd := GetCommand(l.Bars[index].ID, []byte("X"))
+	words, err := l.readBinaryWords(index, "X", "ReadFactors")
+	if err != nil {
+		return nil, err
+	}
+	// skip totalFactor (first word)
+	factors := make([]float64, len(words)-1)
+	for i, bits := range words[1:] {
+		factors[i] = float64(math.Float32frombits(bits))
+	}
+	return factors, nil
+}
+
+// ReadZeros queries a bar for its stored zeros using the 'O' read command.
+// The reply uses the same binary layout as ReadFactors: a 4-byte total zero
+// followed by one 4-byte big-endian unsigned value per active LC.
+func (l *Leo485) ReadZeros(index int) ([]uint64, error) {
+	words, err := l.readBinaryWords(index, "O", "ReadZeros")
+	if err != nil {
+		return nil, err
+	}
+	// skip total zero (first word)
+	zeros := make([]uint64, len(words)-1)
+	for i, v := range words[1:] {
+		zeros[i] = uint64(v)
+	}
+	return zeros, nil
+}
+
+// readBinaryWords sends a single-letter read command to a bar and returns the
+// big-endian 32-bit words of its binary reply: one total word followed by one
+// word per active LC. name prefixes every error for diagnostics.
+func (l *Leo485) readBinaryWords(index int, command string, name string) ([]uint32, error) {
+	cmd := GetCommand(l.Bars[index].ID, []byte(command))
 	// Send command and get raw bytes (no textual parsing)
-	raw, err := sendCommand(l.Serial, cmd, 300)
+	var raw []byte
+	err := l.withPort(func(sp *goserial.Port) (err error) {
+		raw, err = sendCommand(sp, cmd, 300)
+		return err
+	})
 	if err != nil {
-		return nil, fmt.Errorf("ReadFactors sendCommand error: %v", err)
+		return nil, fmt.Errorf("%s sendCommand error: %v", name, err)
 	}
 	if len(raw) < 6 {
-		return nil, fmt.Errorf("ReadFactors: response too short: %d bytes", len(raw))
+		return nil, fmt.Errorf("%s: response too short: %d bytes", name, len(raw))
 	}
 
 	// find CRLF or LF
@@ -183,69 +428,47 @@ func (l *Leo485) ReadFactors(index int) ([]float64, error) {
 		rnPos = bytes.IndexByte(raw, '\n')
 	}
 	if rnPos == -1 {
-		return nil, fmt.Errorf("ReadFactors: no line terminator in response; len=%d", len(raw))
+		return nil, fmt.Errorf("%s: no line terminator in response; len=%d", name, len(raw))
 	}
 
 	// Validate ID bytes (first two bytes of response should match cmd[:2])
 	if len(raw) < 2 || raw[0] != cmd[0] || raw[1] != cmd[1] {
-		// provide a hex dump for diagnostics
-		hexParts := make([]string, 0, len(raw))
-		for _, b := range raw {
-			hexParts = append(hexParts, fmt.Sprintf("%02X", b))
-		}
-		return nil, fmt.Errorf("ReadFactors GetData error: wrong ID or missing pipe; raw_len=%d raw_hex=%s", len(raw), strings.Join(hexParts, " "))
-	}
-
-	if rnPos < 2 {
-		return nil, fmt.Errorf("ReadFactors: response too short before CRC/terminator")
+		return nil, fmt.Errorf("%s GetData error: wrong ID or missing pipe; raw_len=%d raw_hex=%s", name, len(raw), hexDump(raw))
 	}
 
 	// CRC is the two bytes immediately before CR/LF
 	if rnPos < 2 {
-		return nil, fmt.Errorf("ReadFactors: no CRC present")
+		return nil, fmt.Errorf("%s: response too short before CRC/terminator", name)
 	}
 	receivedCRC := raw[rnPos-2 : rnPos]
 	dataForCRC := raw[:rnPos-2]
 	calc := crc16(dataForCRC)
 	if receivedCRC[0] != calc[0] || receivedCRC[1] != calc[1] {
-		// hex dump for diagnostics
-		hexParts := make([]string, 0, len(raw))
-		for _, b := range raw {
-			hexParts = append(hexParts, fmt.Sprintf("%02X", b))
-		}
-		return nil, fmt.Errorf("ReadFactors CRC mismatch: expected=%02X%02X got=%02X%02X raw_hex=%s", calc[0], calc[1], receivedCRC[0], receivedCRC[1], strings.Join(hexParts, " "))
+		return nil, fmt.Errorf("%s CRC mismatch: expected=%02X%02X got=%02X%02X raw_hex=%s", name, calc[0], calc[1], receivedCRC[0], receivedCRC[1], hexDump(raw))
 	}
 
 	// payload starts right after the 2-byte ID (no ASCII pipe expected for binary payloads)
 	payload := raw[2 : rnPos-2]
-	nlcs := l.NLCs
-	expected := 4 * (1 + nlcs) // total + each factor (4 bytes each)
-	if len(payload) < expected {
-		return nil, fmt.Errorf("ReadFactors: payload too short: got %d, want %d", len(payload), expected)
+	nwords := 1 + l.nlcs[index] // total + each LC (4 bytes each)
+	if len(payload) < 4*nwords {
+		return nil, fmt.Errorf("%s: payload too short: got %d, want %d", name, len(payload), 4*nwords)
 	}
-
-	ofs := 4 // skip totalFactor (first 4 bytes)
-	factors := make([]float64, nlcs)
-	for i := 0; i < nlcs; i++ {
-		if ofs+4 > len(payload) {
-			return nil, fmt.Errorf("ReadFactors: payload truncated for factor %d", i)
-		}
-		bits := binary.BigEndian.Uint32(payload[ofs : ofs+4])
-		f32 := math.Float32frombits(bits)
-		factors[i] = float64(f32)
-		ofs += 4
+	words := make([]uint32, nwords)
+	for i := range words {
+		words[i] = binary.BigEndian.Uint32(payload[4*i : 4*i+4])
 	}
-	return factors, nil
+	return words, nil
 }
 
-func numOfActiveLCs(lcs byte) int {
-	count := 0
-	for i := 0; i < 8; i++ {
-		if (lcs & (1 << i)) != 0 {
-			count++
-		}
+// hexDump formats raw bytes as space-separated hex for error messages.
+func hexDump(raw []byte) string {
+	hexParts := make([]string, 0, len(raw))
+	for _, b := range raw {
+		hexParts = append(hexParts, fmt.Sprintf("%02X", b))
 	}
-	return count
+	return strings.Join(hexParts, " ")
 }
 
+func numOfActiveLCs(lcs byte) int { return models.ActiveLCs(lcs) }
+
 // The lower-level serial helpers are implemented in com.go in this package.
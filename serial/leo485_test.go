@@ -0,0 +1,46 @@
+package serial
+
+import (
+	"reflect"
+	"testing"
+
+	models "github.com/CK6170/Calrunrilla-go/models"
+)
+
+func TestLCLayoutRagged(t *testing.T) {
+	// a 4-cell main bar, a 2-cell extension and a 3-cell bar
+	bars := []*models.BAR{{ID: 1, LCS: 0x0F}, {ID: 2, LCS: 0x03}, {ID: 3, LCS: 0x0B}}
+	nlcs, offsets, err := lcLayout(bars)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := []int{4, 2, 3}; !reflect.DeepEqual(nlcs, want) {
+		t.Errorf("nlcs = %v, want %v", nlcs, want)
+	}
+	if want := []int{0, 4, 6}; !reflect.DeepEqual(offsets, want) {
+		t.Errorf("offsets = %v, want %v", offsets, want)
+	}
+
+	l := &Leo485{Bars: bars, nlcs: nlcs, offsets: offsets}
+	if got := l.TotalLCs(); got != 9 {
+		t.Errorf("TotalLCs = %d, want 9", got)
+	}
+	if got := l.MaxNLCs(); got != 4 {
+		t.Errorf("MaxNLCs = %d, want 4", got)
+	}
+	if got := l.LCOffset(2); got != 6 {
+		t.Errorf("LCOffset(2) = %d, want 6", got)
+	}
+	// LCsPerBar hands out a copy
+	l.LCsPerBar()[0] = 0
+	if l.NLCsPerBar(0) != 4 {
+		t.Error("LCsPerBar exposes the internal slice")
+	}
+}
+
+func TestLCLayoutNoActiveLCs(t *testing.T) {
+	bars := []*models.BAR{{ID: 1, LCS: 0x0F}, {ID: 2, LCS: 0}}
+	if _, _, err := lcLayout(bars); err == nil {
+		t.Error("bar without load cells accepted")
+	}
+}
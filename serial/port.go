@@ -1,6 +1,7 @@
 package serial
 
 import (
+	"context"
 	"fmt"
 	"strings"
 	"time"
@@ -11,10 +12,14 @@ import (
 
 // AutoDetectPort scans common COM ports to find one responding to a Version command.
 func AutoDetectPort(parameters *models.PARAMETERS) string {
-	expectedFirstBarID := parameters.BARS[0].ID
-	baud := parameters.SERIAL.BAUDRATE
+	return detectPort(context.Background(), parameters.BARS[0].ID, parameters.SERIAL.BAUDRATE)
+}
+
+// detectPort scans COM1..COM64 for a port where barID answers the version
+// command. It returns "" when none does or once ctx is cancelled.
+func detectPort(ctx context.Context, expectedFirstBarID int, baud int) string {
 	// Scan COM1..COM64
-	for i := 1; i <= 64; i++ {
+	for i := 1; i <= 64 && ctx.Err() == nil; i++ {
 		portName := fmt.Sprintf("COM%d", i)
 		if TestPort(portName, expectedFirstBarID, baud) {
 			return portName
@@ -41,9 +41,9 @@ func main() {
 	}
 
 	// Get weight
-	weight := 1000
+	weight := 1000.0
 	if v, ok := raw["WEIGHT"]; ok {
-		var w int
+		var w float64
 		if err := json.Unmarshal(v, &w); err == nil {
 			weight = w
 		}
@@ -113,29 +113,27 @@ func main() {
 		}
 	}
 	ad0 := matrix.NewMatrix(nloads, nbars*nlcs)
-	for r := 0; r < nloads; r++ {
-		vr := matrix.NewVector(len(zeroRow))
-		copy(vr.Values, zeroRow)
-		ad0.SetRow(r, vr)
-	}
+	ad0.SetAllRows(&matrix.Vector{Length: len(zeroRow), Values: zeroRow})
 
 	fmt.Println(matrix.MatrixLine)
 	fmt.Println("Zero Matrix (ad0)")
 	fmt.Println(matrix.MatrixLine)
-	fmt.Println(ad0.ToStrings("Zero Matrix", "%10.0f"))
+	zeroText, _ := ad0.ToStrings("Zero Matrix", "%10.0f")
+	fmt.Println(zeroText)
 
 	fmt.Println(matrix.MatrixLine)
 	fmt.Println("Weight Matrix (adv)")
 	fmt.Println(matrix.MatrixLine)
-	fmt.Println(adv.ToStrings("Weight Matrix", "%10.0f"))
+	weightText, _ := adv.ToStrings("Weight Matrix", "%10.0f")
+	fmt.Println(weightText)
 
 	add := adv.Sub(ad0)
 
-	w := matrix.NewVectorWithValue(add.Rows, float64(weight))
+	w := matrix.NewVectorWithValue(add.Rows, weight)
 	// Correct calculation: use SVD pseudoinverse
-	adi := add.InverseSVD()
-	if adi == nil {
-		log.Fatalf("SVD failed; cannot compute pseudoinverse")
+	adi, svdInfo, err := add.PseudoInverse()
+	if err != nil {
+		log.Fatalf("cannot compute pseudoinverse: %v", err)
 	}
 	factors := adi.MulVector(w)
 	if factors == nil {
@@ -159,7 +157,7 @@ func main() {
 	fmt.Println(matrix.MatrixLine)
 	fmt.Println("factors (IEEE754)")
 	for i, val := range factors.Values {
-		hex := fmt.Sprintf("%08X", matrix.ToIEEE754(float32(val)))
+		hex := matrix.FormatIEEEHex(float32(val))
 		fmt.Printf("[%03d]  % .12f  %s\n", i, val, hex)
 	}
 	fmt.Println(matrix.MatrixLine)
@@ -173,9 +171,10 @@ func main() {
 	}
 	fmt.Println(matrix.MatrixLine)
 
-	norm := check.Sub(w).Norm() / float64(weight)
+	norm := check.Sub(w).Norm() / weight
 	fmt.Printf("Error: %e\n", norm)
 	fmt.Printf("Pseudoinverse Norm: %e\n", adi.Norm())
+	fmt.Printf("Condition Number: %e (rank %d of %d)\n", svdInfo.Condition, svdInfo.Rank, len(svdInfo.Values))
 
 	// No file output — console-only per user's request
 }